@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/menghanl/release-git-bot/ghapp"
+	"github.com/menghanl/release-git-bot/gitwrapper"
+	"golang.org/x/oauth2"
+)
+
+var (
+	// tokenSource gives the token for the github API and git pushes. It's nil
+	// if there's no -token and no github app.
+	tokenSource oauth2.TokenSource
+	// app is the github app the bot authenticates as, or nil if -token is
+	// used.
+	app *ghapp.App
+)
+
+// initAuth sets tokenSource from the -token flag, or from the github app
+// flags.
+func initAuth() error {
+	if *appID == 0 {
+		if *token != "" {
+			tokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: *token})
+		}
+		return nil
+	}
+	if *token != "" {
+		return fmt.Errorf("-token and -app-id can't be used together")
+	}
+	key, err := ioutil.ReadFile(*appKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read app private key: %v", err)
+	}
+	app, err = ghapp.New(&ghapp.Config{
+		AppID:          *appID,
+		InstallationID: *appInstallationID,
+		PrivateKey:     key,
+		BaseURL:        cfg.APIURL,
+	})
+	if err != nil {
+		return err
+	}
+	tokenSource = app
+	return nil
+}
+
+// gitAuth returns the auth to clone and push to the user's fork, and to fetch
+// from upstream. It's nil if there's no token, to send no credentials.
+func gitAuth(login string) *gitwrapper.AuthConfig {
+	if tokenSource == nil {
+		return nil
+	}
+	if app != nil {
+		// Installation tokens are used with this username.
+		return &gitwrapper.AuthConfig{Username: "x-access-token", TokenSource: tokenSource}
+	}
+	return &gitwrapper.AuthConfig{Username: login, Password: *token}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/menghanl/release-git-bot/gitwrapper"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	backportLabel     = new(string)
+	backportMilestone = new(string)
+	backportCombined  = new(bool)
+)
+
+func backportFlags(fs *flag.FlagSet) {
+	fs.StringVar(backportLabel, "label", "", "the label of the PRs to backport. If not specified, will be backport_label from the config")
+	fs.StringVar(backportMilestone, "milestone", "", "the milestone of the PRs to backport, instead of the label")
+	fs.BoolVar(backportCombined, "combined", false, "if true, send one PR with all the backports, instead of one PR per backport")
+}
+
+// backport is one PR to be cherry-picked to the release branch.
+type backport struct {
+	pr     *github.Issue
+	commit string
+	result *gitwrapper.CherryPickResult
+}
+
+// runBackport cherry-picks the merged PRs with the backport label (or
+// milestone) onto the release branch, and sends PRs to the release branch.
+func runBackport(ctx context.Context) error {
+	label := *backportLabel
+	if label == "" {
+		label = cfg.BackportLabel
+	}
+	if label == "" && *backportMilestone == "" {
+		return fmt.Errorf("no backport label or milestone, set -label, -milestone or backport_label in the config")
+	}
+
+	r, err := newReleaser(ctx, newSingleStepState(), true)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	releaseBranch := r.state.ReleaseBranch
+
+	var prs []*github.Issue
+	if *backportMilestone != "" {
+		fmt.Printf(" - Finding merged PRs in milestone %q\n\n", *backportMilestone)
+		prs, err = r.upstream.GetMergedPRsForMilestone(ctx, *backportMilestone)
+	} else {
+		fmt.Printf(" - Finding merged PRs with label %q\n\n", label)
+		prs, err = r.upstream.GetMergedPRsForLabels(ctx, []string{label})
+	}
+	if err == nil {
+		prs, err = r.mergedAfterBranchPoint(ctx, prs, releaseBranch)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find the PRs to backport: %v", err)
+	}
+	if len(prs) == 0 {
+		fmt.Println("No PRs to backport")
+		return nil
+	}
+	// Cherry-pick in the order they were merged.
+	sort.Slice(prs, func(i, j int) bool {
+		return prs[i].GetClosedAt().Before(prs[j].GetClosedAt())
+	})
+
+	var backports []*backport
+	for _, pr := range prs {
+		commit, err := r.upstream.CommitIDForMergedPR(ctx, pr)
+		if err != nil {
+			return fmt.Errorf("failed to find the merge commit for PR #%v: %v", pr.GetNumber(), err)
+		}
+		if commit == "" {
+			return fmt.Errorf("failed to find the merge commit for PR #%v", pr.GetNumber())
+		}
+		backports = append(backports, &backport{pr: pr, commit: commit})
+	}
+
+	// Fetch the release branch to base the changes on, and the base branch to
+	// have the merged commits.
+	for _, b := range []string{releaseBranch, cfg.BaseBranch} {
+		if err := r.local.FetchRemoteBranch(upstreamRemote, b); err != nil {
+			return err
+		}
+	}
+
+	if *backportCombined {
+		branchName := fmt.Sprintf("backport_%v", r.ver.String())
+		var commits []string
+		for _, b := range backports {
+			commits = append(commits, b.commit)
+		}
+		if err := r.cherryPick(backports, commits, releaseBranch, branchName); err != nil {
+			return err
+		}
+		var applied []*backport
+		for _, b := range backports {
+			if b.result.Applied {
+				applied = append(applied, b)
+			}
+		}
+		if len(applied) > 0 {
+			var body []string
+			for _, b := range applied {
+				body = append(body, fmt.Sprintf(" * %v (#%v)", b.pr.GetTitle(), b.pr.GetNumber()))
+			}
+			title := fmt.Sprintf("Backport %v PRs to %v", len(applied), releaseBranch)
+			prURL, err := r.publish(ctx, branchName, releaseBranch, title, strings.Join(body, "\n"))
+			if err != nil {
+				return err
+			}
+			fmt.Println("PR to merge: ", prURL)
+		}
+	} else {
+		for _, b := range backports {
+			branchName := fmt.Sprintf("backport_%v_to_%v", b.pr.GetNumber(), releaseBranch)
+			if err := r.cherryPick([]*backport{b}, []string{b.commit}, releaseBranch, branchName); err != nil {
+				return err
+			}
+			if !b.result.Applied {
+				continue
+			}
+			title := fmt.Sprintf("Cherry-pick #%v to %v", b.pr.GetNumber(), releaseBranch)
+			body := fmt.Sprintf("Backport of %v", b.pr.GetHTMLURL())
+			prURL, err := r.publish(ctx, branchName, releaseBranch, title, body)
+			if err != nil {
+				return err
+			}
+			fmt.Println("PR to merge: ", prURL)
+		}
+	}
+
+	fmt.Println()
+	var failed bool
+	for _, b := range backports {
+		switch {
+		case b.result.Applied:
+			fmt.Printf(" * #%v applied\n", b.pr.GetNumber())
+		case b.result.Empty:
+			fmt.Printf(" * #%v skipped, already on %v\n", b.pr.GetNumber(), releaseBranch)
+		default:
+			failed = true
+			fmt.Printf(" * #%v (%v) conflicts with the changes on %v in: %v\n", b.pr.GetNumber(), b.commit, releaseBranch, strings.Join(b.result.Conflicts, ", "))
+		}
+	}
+	if failed {
+		return fmt.Errorf("some PRs don't apply cleanly, cherry-pick them manually")
+	}
+	return nil
+}
+
+// mergedAfterBranchPoint returns the PRs merged after the release branch was
+// branched from the base branch. The label or milestone stays on the PRs after
+// they are backported, and the ones merged before are already on the release
+// branch.
+func (r *releaser) mergedAfterBranchPoint(ctx context.Context, prs []*github.Issue, releaseBranch string) ([]*github.Issue, error) {
+	mergeBase, err := r.upstream.MergeBase(ctx, cfg.BaseBranch, releaseBranch)
+	if err != nil {
+		return nil, err
+	}
+	branchPoint, err := r.upstream.CommitDate(ctx, mergeBase)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*github.Issue
+	for _, pr := range prs {
+		if pr.GetClosedAt().After(branchPoint) {
+			ret = append(ret, pr)
+		}
+	}
+	log.Infof("%v of the %v PRs were merged after %v was branched at %v", len(ret), len(prs), releaseBranch, mergeBase)
+	return ret, nil
+}
+
+// cherryPick cherry-picks the commits onto a new branch based on upstream's
+// base, and fills in the results in backports.
+func (r *releaser) cherryPick(backports []*backport, commits []string, base, branchName string) error {
+	results, err := r.local.CherryPick(&gitwrapper.CherryPickConfig{
+		Commits:    commits,
+		BaseBranch: base,
+		BaseRemote: upstreamRemote,
+		BranchName: branchName,
+		UserName:   r.name,
+		UserEmail:  r.email,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cherry-pick: %v", err)
+	}
+	for i, res := range results {
+		backports[i].result = res
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/menghanl/release-git-bot/notes"
+)
+
+// runRelease runs all the release steps, saving the progress to the state
+// file.
+func runRelease(ctx context.Context) error {
+	if *rc && !*resume {
+		ver, err := semver.Make(*newVersion)
+		if err != nil {
+			return fmt.Errorf("invalid version string %q: %v", *newVersion, err)
+		}
+		upstream, err := newUpstreamClient()
+		if err != nil {
+			return err
+		}
+		if ver, err = nextPrerelease(ctx, upstream, ver); err != nil {
+			return fmt.Errorf("failed to get the next release candidate version: %v", err)
+		}
+		*newVersion = ver.String()
+	}
+	state, err := initReleaseState()
+	if err != nil {
+		return err
+	}
+	r, err := newReleaser(ctx, state, true)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	if err := r.run(ctx); err != nil {
+		return fmt.Errorf("%v. Fix the problem and rerun with -resume to continue from the failed step", err)
+	}
+
+	/* Step 6: finish steps as in g3doc */
+	fmt.Println()
+	fmt.Println("Not done yet. Send the emails and add compatibility test.")
+	return nil
+}
+
+var notesFormat = new(string)
+
+func notesFlags(fs *flag.FlagSet) {
+	fs.StringVar(notesFormat, "format", "markdown", "the format of the release notes, one of "+strings.Join(notes.Formats(), ", "))
+}
+
+// runNotes prints the release notes in the -format.
+func runNotes(ctx context.Context) error {
+	ver, err := semver.Make(*newVersion)
+	if err != nil {
+		return fmt.Errorf("invalid version string %q: %v", *newVersion, err)
+	}
+	renderer, err := notesRenderer(*notesFormat)
+	if err != nil {
+		return err
+	}
+	upstream, err := newUpstreamClient()
+	if err != nil {
+		return err
+	}
+	ns, err := releaseNote(ctx, upstream, ver)
+	if err != nil {
+		return err
+	}
+	s, err := renderer.Render(ns)
+	if err != nil {
+		return err
+	}
+	fmt.Println(s)
+	return nil
+}
+
+// runNotesAudit checks the merged PRs of the release for the problems that
+// make the release notes wrong, and fails if any is found, so it can gate the
+// release.
+func runNotesAudit(ctx context.Context) error {
+	ver, err := semver.Make(*newVersion)
+	if err != nil {
+		return fmt.Errorf("invalid version string %q: %v", *newVersion, err)
+	}
+	upstream, err := newUpstreamClient()
+	if err != nil {
+		return err
+	}
+	prs, milestone, err := auditPRs(ctx, upstream, ver)
+	if err != nil {
+		return err
+	}
+	res := notes.Audit(prs, milestone, labelConfig())
+
+	printFindings := func(title string, fs []*notes.Finding) {
+		if len(fs) == 0 {
+			return
+		}
+		fmt.Println(title)
+		for _, f := range fs {
+			fmt.Printf(" - #%v %v (%v): %v\n", f.PR.GetNumber(), f.PR.GetTitle(), f.PR.GetHTMLURL(), f.Reason)
+		}
+		fmt.Println()
+	}
+	printFindings("Problems:", res.Problems)
+	printFindings("Left out of the notes:", res.Omitted)
+	if len(res.Problems) > 0 {
+		return fmt.Errorf("found %v problems in the %v merged PRs of %v", len(res.Problems), len(prs), ver)
+	}
+	fmt.Printf("No problems found in the %v merged PRs of %v.\n", len(prs), ver)
+	return nil
+}
+
+// runBranch creates the upstream release branch.
+func runBranch(ctx context.Context) error {
+	r, err := newReleaser(ctx, newSingleStepState(), false)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	return r.createReleaseBranch(ctx)
+}
+
+var bumpBase = new(string)
+
+func bumpFlags(fs *flag.FlagSet) {
+	fs.StringVar(bumpBase, "base", "", "the upstream branch to send the PR to. If not specified, will be the release branch for the version")
+}
+
+// runBump sends a PR to change the version to the -version flag.
+func runBump(ctx context.Context) error {
+	r, err := newReleaser(ctx, newSingleStepState(), true)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	base := *bumpBase
+	if base == "" {
+		base = r.state.ReleaseBranch
+	}
+	prURL, err := r.makePR(ctx, *newVersion, base)
+	if err != nil {
+		return err
+	}
+	fmt.Println("PR to merge: ", prURL)
+	return nil
+}
+
+// runDraft generates the release notes and creates the draft release.
+func runDraft(ctx context.Context) error {
+	r, err := newReleaser(ctx, newSingleStepState(), false)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	return r.createDraftRelease(ctx)
+}
+
+// runPostRelease sends the PRs to change the version to -dev.
+func runPostRelease(ctx context.Context) error {
+	r, err := newReleaser(ctx, newSingleStepState(), true)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	if err := r.makeReleaseBranchDevPR(ctx); err != nil {
+		return err
+	}
+	fmt.Println()
+	return r.makeMasterDevPR(ctx)
+}
+
+// newSingleStepState returns a state for a command that runs a single step.
+// It's not saved to file.
+func newSingleStepState() *releaseState {
+	s := newReleaseState("")
+	s.Version = *newVersion
+	s.UpstreamUser = upstreamUser
+	s.Repo = *repo
+	return s
+}
+
+// initReleaseState loads the release state from the state file if -resume is
+// set, or creates a new state otherwise.
+//
+// It fails if the state doesn't match the flags, or if there's an unfinished
+// release in the state file and -resume is not set.
+//
+// In dry run, the state is never saved.
+func initReleaseState() (*releaseState, error) {
+	s, err := loadOrNewReleaseState()
+	if err != nil {
+		return nil, err
+	}
+	if recorder != nil {
+		s.path = ""
+	}
+	return s, nil
+}
+
+// releaseOf returns the final release of the version, e.g. 1.15.0 for
+// 1.15.0-rc.1, or version itself if it's not a valid version.
+func releaseOf(version string) string {
+	v, err := semver.Make(version)
+	if err != nil {
+		return version
+	}
+	v.Pre = nil
+	return v.String()
+}
+
+func loadOrNewReleaseState() (*releaseState, error) {
+	if !*resume {
+		if s, err := loadReleaseState(*stateFile); err == nil && len(s.CompletedSteps) < len(releaseSteps) {
+			return nil, fmt.Errorf("state file %q contains an unfinished release of %v, rerun with -resume to continue it, or delete the file to start over", *stateFile, s.Version)
+		}
+		s := newReleaseState(*stateFile)
+		s.Version = *newVersion
+		s.UpstreamUser = upstreamUser
+		s.Repo = *repo
+		return s, nil
+	}
+
+	s, err := loadReleaseState(*stateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state to resume: %v", err)
+	}
+	if *newVersion == "" {
+		// Allow omitting -version when resuming.
+		*newVersion = s.Version
+	}
+	if s.Version != *newVersion && !(*rc && releaseOf(s.Version) == *newVersion) {
+		return nil, fmt.Errorf("state file %q is for version %v, not %v", *stateFile, s.Version, *newVersion)
+	}
+	// With -rc, -version is the final release, and the state has the release
+	// candidate.
+	*newVersion = s.Version
+	if s.UpstreamUser != upstreamUser || s.Repo != *repo {
+		return nil, fmt.Errorf("state file %q is for %v/%v, not %v/%v", *stateFile, s.UpstreamUser, s.Repo, upstreamUser, *repo)
+	}
+	return s, nil
+}
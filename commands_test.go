@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigUpstream(t *testing.T) {
+	saveGlobals(t,
+		token, appID, appInstallationID, appKeyFile, newVersion, nokidding,
+		dryRun, yes, concurrency, configFile, repo, upstream, baseBranch,
+		apiURL, uploadURL, gitURL,
+	)
+
+	for _, tt := range []struct {
+		name             string
+		args             []string
+		wantUpstream     string
+		wantTestUpstream string
+	}{
+		{name: "default", wantUpstream: "grpc", wantTestUpstream: "menghanl"},
+		{name: "nokidding", args: []string{"-nokidding", "-upstream", "grpc-ecosystem"}, wantUpstream: "grpc-ecosystem", wantTestUpstream: "menghanl"},
+		{name: "test", args: []string{"-upstream", "gopher"}, wantUpstream: "grpc", wantTestUpstream: "gopher"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			githubFlags(fs)
+			args := append([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, tt.args...)
+			if err := fs.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+			c, err := loadConfig(fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.UpstreamUser != tt.wantUpstream || c.TestUpstreamUser != tt.wantTestUpstream {
+				t.Errorf("loadConfig(%q) upstreams = %v, %v, want %v, %v", tt.args, c.UpstreamUser, c.TestUpstreamUser, tt.wantUpstream, tt.wantTestUpstream)
+			}
+		})
+	}
+}
+
+func TestLoadOrNewReleaseStateResume(t *testing.T) {
+	saveGlobals(t, &upstreamUser, repo, newVersion, rc, resume, stateFile)
+	upstreamUser = "grpc"
+	*repo = "grpc-go"
+	*resume = true
+
+	for _, tt := range []struct {
+		name    string
+		state   string
+		version string
+		rc      bool
+		wantErr string
+	}{
+		{name: "same version", state: "1.15.0", version: "1.15.0"},
+		{name: "no version", state: "1.15.0"},
+		{name: "other version", state: "1.15.0", version: "1.16.0", wantErr: "is for version 1.15.0, not 1.16.0"},
+		{name: "rc", state: "1.15.0-rc.2", version: "1.15.0", rc: true},
+		{name: "rc version", state: "1.15.0-rc.2", version: "1.15.0-rc.2", rc: true},
+		{name: "rc of other version", state: "1.15.0-rc.2", version: "1.16.0", rc: true, wantErr: "is for version 1.15.0-rc.2, not 1.16.0"},
+		{name: "rc without -rc", state: "1.15.0-rc.2", version: "1.15.0", wantErr: "is for version 1.15.0-rc.2, not 1.15.0"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			*stateFile = filepath.Join(t.TempDir(), "state.json")
+			s := newReleaseState(*stateFile)
+			s.Version = tt.state
+			s.UpstreamUser = upstreamUser
+			s.Repo = *repo
+			if err := s.save(); err != nil {
+				t.Fatal(err)
+			}
+			*newVersion = tt.version
+			*rc = tt.rc
+
+			got, err := loadOrNewReleaseState()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("loadOrNewReleaseState() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadOrNewReleaseState() failed: %v", err)
+			}
+			if got.Version != tt.state || *newVersion != tt.state {
+				t.Errorf("loadOrNewReleaseState() version = %v, -version = %v, want %v", got.Version, *newVersion, tt.state)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Package config defines the per repo settings of the release bot, and loads
+// them from a YAML file.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config contains the settings of the repo to be released.
+type Config struct {
+	// UpstreamUser is the owner of the upstream repo, e.g. "grpc".
+	UpstreamUser string `yaml:"upstream_user"`
+	// TestUpstreamUser is the owner of the upstream repo used when not
+	// -nokidding, to test the release in a fork.
+	TestUpstreamUser string `yaml:"test_upstream_user"`
+	// Repo is the repo name, e.g. "grpc-go".
+	Repo string `yaml:"repo"`
+	// BaseBranch is the branch release branches are created from, and the
+	// branch to send the next -dev version PR to.
+	BaseBranch string `yaml:"base_branch"`
+
+	// APIURL is the URL of the github API, e.g.
+	// "https://github.example.com/api/v3/" for GitHub Enterprise. If empty,
+	// the public github API is used.
+	APIURL string `yaml:"api_url"`
+	// UploadURL is the upload URL of the github API, e.g.
+	// "https://github.example.com/api/uploads/". If empty, it's derived from
+	// APIURL.
+	UploadURL string `yaml:"upload_url"`
+	// GitURL is the URL repos are cloned from and pushed to, the repo
+	// owner/repo is at GitURL/owner/repo. If empty, "https://github.com" is
+	// used.
+	GitURL string `yaml:"git_url"`
+
+	// VersionFiles are the files with the version number, all of them are
+	// changed in the version PRs.
+	VersionFiles []*VersionFile `yaml:"version_files"`
+
+	// MilestoneFormat is the format of the milestone titles, with the major
+	// and minor version numbers as arguments.
+	MilestoneFormat string `yaml:"milestone_format"`
+	// PrereleaseFormat is the format of the pre-release part of release
+	// candidate versions, with the candidate number as argument, e.g. "rc.%v"
+	// for 1.15.0-rc.1.
+	PrereleaseFormat string `yaml:"prerelease_format"`
+
+	// BackportLabel is the label of the merged PRs to be cherry-picked to the
+	// release branch by the backport command.
+	BackportLabel string `yaml:"backport_label"`
+
+	// ThanksOrg is the github org whose members are not thanked in the
+	// release notes.
+	ThanksOrg string `yaml:"thanks_org"`
+
+	// NotesSource is where the PRs in the release notes are found,
+	// NotesFromMilestone or NotesFromCommits. If empty, NotesFromMilestone is
+	// used.
+	NotesSource string `yaml:"notes_source"`
+	// NotesTemplate is the path of a Go text/template file for the markdown
+	// release notes. If empty, notes.DefaultTemplate is used.
+	NotesTemplate string `yaml:"notes_template"`
+	// Labels maps the labels of the PRs to the sections of the release notes.
+	// If nil, the grpc-go labels are used, see notes.DefaultLabelConfig.
+	Labels *Labels `yaml:"labels"`
+	// Areas, if set, groups the entries of each section of the release notes
+	// by area.
+	Areas *Areas `yaml:"areas"`
+}
+
+// Labels maps the labels of the PRs to the sections of the release notes.
+type Labels struct {
+	// Prefix is trimmed from the labels before they are matched with the
+	// section labels, e.g. "Type: ".
+	Prefix string `yaml:"prefix"`
+	// Sections are the section labels, most important first. A PR with more
+	// than one section label is in the first section, and the sections are
+	// in this order in the notes.
+	Sections []*SectionLabel `yaml:"sections"`
+	// Default is the section label of the PRs without any of the section
+	// labels. If empty, those PRs are not in the notes.
+	Default string `yaml:"default"`
+	// Exclude are the labels, without trimming Prefix, that exclude a PR from
+	// the notes.
+	Exclude []string `yaml:"exclude"`
+}
+
+// SectionLabel is a label that puts a PR in a section of the release notes.
+type SectionLabel struct {
+	// Label is the label, without the prefix.
+	Label string `yaml:"label"`
+	// Name is the section name. If empty, the PRs with this label are not in
+	// the notes.
+	Name string `yaml:"name"`
+}
+
+// Areas is how the areas of the PRs are found, to group the entries of the
+// release notes sections by area. At least one of the fields should be set.
+type Areas struct {
+	// LabelPrefix is the prefix of the area labels, e.g. "Area: ".
+	LabelPrefix string `yaml:"label_prefix"`
+	// FromTitle, if true, takes the area of the PRs without an area label
+	// from the package prefix of the title, e.g. "xds" for "xds: fix a crash".
+	FromTitle bool `yaml:"from_title"`
+}
+
+// The sources of the PRs in the release notes.
+const (
+	// NotesFromMilestone finds the merged PRs in the release's milestone. For
+	// patch releases, the PRs are found from the commit messages since the
+	// previous patch release.
+	NotesFromMilestone = "milestone"
+	// NotesFromCommits finds the merged PRs associated with the commits since
+	// the previous release, and reports the PRs that are not in the same
+	// milestone.
+	NotesFromCommits = "commits"
+)
+
+// VersionFile describes where the version is in a file. Exactly one of
+// GoConst and Pattern should be set.
+type VersionFile struct {
+	// Path is the path of the file in the repo.
+	Path string `yaml:"path"`
+	// GoConst is the name of a Go string const that holds the version.
+	GoConst string `yaml:"go_const"`
+	// Pattern is a regexp with one capturing group that matches the version.
+	Pattern string `yaml:"pattern"`
+}
+
+// Default returns the config for grpc-go.
+func Default() *Config {
+	return &Config{
+		UpstreamUser:     "grpc",
+		TestUpstreamUser: "menghanl",
+		Repo:             "grpc-go",
+		BaseBranch:       "master",
+		VersionFiles: []*VersionFile{
+			{Path: "version.go", GoConst: "Version"},
+		},
+		MilestoneFormat:  "%v.%v Release",
+		PrereleaseFormat: "rc.%v",
+		ThanksOrg:        "grpc",
+	}
+}
+
+// Load reads the config from the YAML file. Fields not in the file keep the
+// values from Default.
+func Load(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := Default()
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %q: %v", path, err)
+	}
+	if len(c.VersionFiles) == 0 {
+		c.VersionFiles = Default().VersionFiles
+	}
+	for _, f := range c.VersionFiles {
+		if f.Path == "" || (f.GoConst == "") == (f.Pattern == "") {
+			return nil, fmt.Errorf("config file %q: each version file needs a path, and exactly one of go_const and pattern", path)
+		}
+	}
+	if c.NotesSource != "" && c.NotesSource != NotesFromMilestone && c.NotesSource != NotesFromCommits {
+		return nil, fmt.Errorf("config file %q: notes_source must be %q or %q", path, NotesFromMilestone, NotesFromCommits)
+	}
+	if c.Labels != nil {
+		if err := c.Labels.validate(); err != nil {
+			return nil, fmt.Errorf("config file %q: %v", path, err)
+		}
+	}
+	if c.Areas != nil && c.Areas.LabelPrefix == "" && !c.Areas.FromTitle {
+		return nil, fmt.Errorf("config file %q: areas needs label_prefix, or from_title: true", path)
+	}
+	return c, nil
+}
+
+func (l *Labels) validate() error {
+	if len(l.Sections) == 0 {
+		return fmt.Errorf("labels needs at least one section")
+	}
+	seen := make(map[string]bool)
+	for _, s := range l.Sections {
+		if s.Label == "" {
+			return fmt.Errorf("each label section needs a label")
+		}
+		if seen[s.Label] {
+			return fmt.Errorf("label %q is in more than one section", s.Label)
+		}
+		seen[s.Label] = true
+	}
+	if l.Default != "" && !seen[l.Default] {
+		return fmt.Errorf("the default label %q is not one of the section labels", l.Default)
+	}
+	return nil
+}
+
+// LoadOrDefault is like Load, but returns Default if the file doesn't exist.
+func LoadOrDefault(path string) (*Config, error) {
+	c, err := Load(path)
+	if os.IsNotExist(err) {
+		return Default(), nil
+	}
+	return c, err
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		yaml    string
+		want    func(c *Config)
+		wantErr string
+	}{
+		{
+			name: "empty",
+			want: func(c *Config) {},
+		},
+		{
+			name: "fields",
+			yaml: "upstream_user: grpc\nrepo: grpc-java\nbase_branch: main\nmilestone_format: \"%v.%v\"\n",
+			want: func(c *Config) {
+				c.Repo = "grpc-java"
+				c.BaseBranch = "main"
+				c.MilestoneFormat = "%v.%v"
+			},
+		},
+		{
+			name: "version files",
+			yaml: "version_files:\n- path: build.gradle\n  pattern: \"version = '(.*)'\"\n",
+			want: func(c *Config) {
+				c.VersionFiles = []*VersionFile{{Path: "build.gradle", Pattern: "version = '(.*)'"}}
+			},
+		},
+		{
+			name: "labels and areas",
+			yaml: "labels:\n  prefix: \"Type: \"\n  sections:\n  - label: Bug\n    name: Fixes\n  - label: Testing\n  default: Bug\n" +
+				"areas:\n  from_title: true\n",
+			want: func(c *Config) {
+				c.Labels = &Labels{
+					Prefix:   "Type: ",
+					Sections: []*SectionLabel{{Label: "Bug", Name: "Fixes"}, {Label: "Testing"}},
+					Default:  "Bug",
+				}
+				c.Areas = &Areas{FromTitle: true}
+			},
+		},
+		{
+			name:    "unknown field",
+			yaml:    "upstream: grpc\n",
+			wantErr: "failed to parse config file",
+		},
+		{
+			name:    "version file without path",
+			yaml:    "version_files:\n- go_const: Version\n",
+			wantErr: "each version file needs a path, and exactly one of go_const and pattern",
+		},
+		{
+			name:    "version file with both",
+			yaml:    "version_files:\n- path: version.go\n  go_const: Version\n  pattern: \"(.*)\"\n",
+			wantErr: "each version file needs a path, and exactly one of go_const and pattern",
+		},
+		{
+			name:    "notes source",
+			yaml:    "notes_source: tags\n",
+			wantErr: `notes_source must be "milestone" or "commits"`,
+		},
+		{
+			name:    "labels without sections",
+			yaml:    "labels:\n  prefix: \"Type: \"\n",
+			wantErr: "labels needs at least one section",
+		},
+		{
+			name:    "label section without label",
+			yaml:    "labels:\n  sections:\n  - name: Fixes\n",
+			wantErr: "each label section needs a label",
+		},
+		{
+			name:    "label in two sections",
+			yaml:    "labels:\n  sections:\n  - label: Bug\n  - label: Bug\n",
+			wantErr: `label "Bug" is in more than one section`,
+		},
+		{
+			name:    "unknown default label",
+			yaml:    "labels:\n  sections:\n  - label: Bug\n  default: Feature\n",
+			wantErr: `the default label "Feature" is not one of the section labels`,
+		},
+		{
+			name:    "empty areas",
+			yaml:    "areas:\n  from_title: false\n",
+			wantErr: "areas needs label_prefix, or from_title: true",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := ioutil.WriteFile(path, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Load(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() failed: %v", err)
+			}
+			want := Default()
+			tt.want(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Load() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadOrDefault(t *testing.T) {
+	got, err := LoadOrDefault(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err != nil || !reflect.DeepEqual(got, Default()) {
+		t.Errorf("LoadOrDefault() of a missing file = %+v, %v, want Default()", got, err)
+	}
+
+	if _, err := LoadOrDefault(t.TempDir()); err == nil || os.IsNotExist(err) {
+		t.Errorf("LoadOrDefault() of a directory = %v, want a read error", err)
+	}
+}
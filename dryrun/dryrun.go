@@ -0,0 +1,64 @@
+// Package dryrun records the mutations a release would make, so they can be
+// printed as a plan instead of being performed.
+package dryrun
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Mutation is one change that would have been made.
+type Mutation struct {
+	// Kind is the kind of the mutation, for example "CreateRef" or "push".
+	Kind string
+	// Summary is a one line description of the mutation.
+	Summary string
+	// Detail is the content of the mutation, for example the diff to be
+	// pushed, or the body of the release. It can be empty.
+	Detail string
+}
+
+// Recorder records mutations.
+//
+// A nil *Recorder means it's not a dry run. Packages that take a Recorder
+// perform the mutations if it's nil, and record them otherwise.
+type Recorder struct {
+	mutations []*Mutation
+}
+
+// New creates a new Recorder.
+func New() *Recorder {
+	return &Recorder{}
+}
+
+// Record records a mutation.
+func (r *Recorder) Record(kind, summary, detail string) {
+	r.mutations = append(r.mutations, &Mutation{
+		Kind:    kind,
+		Summary: summary,
+		Detail:  detail,
+	})
+}
+
+// Mutations returns all the recorded mutations, in the order they were
+// recorded.
+func (r *Recorder) Mutations() []*Mutation {
+	return r.mutations
+}
+
+// Print prints the plan, all the mutations with their details, to w.
+func (r *Recorder) Print(w io.Writer) {
+	fmt.Fprintf(w, "Dry run, %v mutation(s) not performed:\n\n", len(r.mutations))
+	for i, m := range r.mutations {
+		fmt.Fprintf(w, "%v. [%v] %v\n", i+1, m.Kind, m.Summary)
+		if m.Detail == "" {
+			continue
+		}
+		fmt.Fprintln(w)
+		for _, l := range strings.Split(strings.TrimRight(m.Detail, "\n"), "\n") {
+			fmt.Fprintf(w, "    %v\n", l)
+		}
+		fmt.Fprintln(w)
+	}
+}
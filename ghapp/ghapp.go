@@ -0,0 +1,243 @@
+// Package ghapp authenticates as a GitHub App installation.
+//
+// A JWT signed with the app's private key is exchanged for an installation
+// token, which is used like a personal access token, for the API and for git.
+// Installation tokens expire after an hour, so they are refreshed before they
+// expire.
+package ghapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	defaultBaseURL = "https://api.github.com/"
+
+	// jwtLifetime is how long the JWTs are valid. Github allows at most 10
+	// minutes.
+	jwtLifetime = 9 * time.Minute
+	// clockSkew is how far in the past the JWTs are issued, in case the
+	// clocks don't agree.
+	clockSkew = time.Minute
+	// refreshBefore is how long before the installation token expires it is
+	// refreshed, so a token is never used right when it expires.
+	refreshBefore = 5 * time.Minute
+
+	// The apps API was in preview when go-github v17 was released.
+	acceptHeader = "application/vnd.github.machine-man-preview+json"
+)
+
+// Config contains the settings to authenticate as an app installation.
+type Config struct {
+	// AppID is the ID of the app.
+	AppID int64
+	// InstallationID is the ID of the app's installation in the org or repo.
+	InstallationID int64
+	// PrivateKey is the app's private key, PEM encoded.
+	PrivateKey []byte
+
+	// BaseURL is the URL of the github API. If empty, the public github API
+	// will be used.
+	BaseURL string
+	// HTTPClient is the client to send requests with. If nil,
+	// http.DefaultClient will be used.
+	HTTPClient *http.Client
+}
+
+// App authenticates as an app installation.
+//
+// App is an oauth2.TokenSource of installation tokens. The same token is
+// returned until it's about to expire.
+type App struct {
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	baseURL        string
+	hc             *http.Client
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// New creates an App with the config. No requests are sent until a token is
+// needed.
+func New(c *Config) (*App, error) {
+	if c.AppID == 0 || c.InstallationID == 0 {
+		return nil, fmt.Errorf("app ID and installation ID are required")
+	}
+	key, err := parsePrivateKey(c.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app private key: %v", err)
+	}
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &App{
+		appID:          c.AppID,
+		installationID: c.InstallationID,
+		key:            key,
+		baseURL:        baseURL,
+		hc:             hc,
+	}, nil
+}
+
+// parsePrivateKey parses a PEM encoded RSA key, in PKCS#1 (as downloaded from
+// github) or PKCS#8.
+func parsePrivateKey(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// JWT returns a new JWT to authenticate as the app, signed with RS256.
+func (a *App) JWT() (string, error) {
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-clockSkew).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": a.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %v", err)
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// Token returns an installation token, creating a new one if there's none, or
+// if it's about to expire.
+func (a *App) Token() (*oauth2.Token, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != nil && time.Now().Before(a.token.Expiry) {
+		return a.token, nil
+	}
+	var resp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := fmt.Sprintf("app/installations/%v/access_tokens", a.installationID)
+	if err := a.do(context.Background(), "POST", path, &resp); err != nil {
+		return nil, fmt.Errorf("failed to create installation token: %v", err)
+	}
+	a.token = &oauth2.Token{
+		AccessToken: resp.Token,
+		TokenType:   "token",
+		// Expiry is when the token should be refreshed, not when it
+		// expires.
+		Expiry: resp.ExpiresAt.Add(-refreshBefore),
+	}
+	return a.token, nil
+}
+
+// BotIdentity returns the name and email of the app's bot user, so commits
+// made by the app are attributed to it, e.g. "my-app[bot]" and
+// "12345+my-app[bot]@users.noreply.github.com".
+func (a *App) BotIdentity(ctx context.Context) (name, email string, err error) {
+	var app struct {
+		Slug string `json:"slug"`
+	}
+	if err := a.do(ctx, "GET", "app", &app); err != nil {
+		return "", "", fmt.Errorf("failed to get app: %v", err)
+	}
+	name = app.Slug + "[bot]"
+	// JWTs are only accepted by the app endpoints, the user is got with an
+	// installation token.
+	tok, err := a.Token()
+	if err != nil {
+		return "", "", err
+	}
+	var user struct {
+		ID int64 `json:"id"`
+	}
+	if err := a.send(ctx, "GET", "users/"+name, "token "+tok.AccessToken, &user); err != nil {
+		return "", "", fmt.Errorf("failed to get bot user %v: %v", name, err)
+	}
+	return name, fmt.Sprintf("%v+%v@users.noreply.github.com", user.ID, name), nil
+}
+
+// do sends a request authenticated with a JWT, and decodes the JSON response
+// into v.
+func (a *App) do(ctx context.Context, method, path string, v interface{}) error {
+	jwt, err := a.JWT()
+	if err != nil {
+		return err
+	}
+	return a.send(ctx, method, path, "Bearer "+jwt, v)
+}
+
+// send sends a request with the Authorization header, and decodes the JSON
+// response into v.
+func (a *App) send(ctx context.Context, method, path, authorization string, v interface{}) error {
+	req, err := http.NewRequest(method, a.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Accept", acceptHeader)
+	resp, err := a.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(b, &e)
+		return fmt.Errorf("%v %v: %v %v", method, path, resp.StatusCode, e.Message)
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,166 @@
+package ghapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/menghanl/release-git-bot/internal/fakegithub"
+)
+
+const (
+	testAppID          = 1
+	testInstallationID = 2
+)
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func pkcs1PEM(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// newTestApp starts a fake github with the app installed, and returns the App
+// authenticating as it.
+func newTestApp(t *testing.T) (*App, *fakegithub.Server) {
+	fake, err := fakegithub.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fake.Close)
+	key := newTestKey(t)
+	fake.SetApp(testAppID, testInstallationID, "release-bot", &key.PublicKey)
+	a, err := New(&Config{
+		AppID:          testAppID,
+		InstallationID: testInstallationID,
+		PrivateKey:     pkcs1PEM(key),
+		BaseURL:        fake.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, fake
+}
+
+func TestJWT(t *testing.T) {
+	key := newTestKey(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		pem  []byte
+	}{
+		{name: "pkcs1", pem: pkcs1PEM(key)},
+		{name: "pkcs8", pem: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := New(&Config{AppID: testAppID, InstallationID: testInstallationID, PrivateKey: tt.pem})
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now().Unix()
+			jwt, err := a.JWT()
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts := strings.Split(jwt, ".")
+			if len(parts) != 3 {
+				t.Fatalf("JWT() = %q, want three parts", jwt)
+			}
+			enc := base64.RawURLEncoding
+			sig, err := enc.DecodeString(parts[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], sig); err != nil {
+				t.Errorf("JWT() signature doesn't match the key: %v", err)
+			}
+
+			var header map[string]string
+			if b, err := enc.DecodeString(parts[0]); err != nil || json.Unmarshal(b, &header) != nil {
+				t.Fatalf("JWT() header %q is not base64 JSON", parts[0])
+			}
+			if header["alg"] != "RS256" || header["typ"] != "JWT" {
+				t.Errorf("JWT() header = %v, want alg RS256 and typ JWT", header)
+			}
+			var claims struct {
+				Iat, Exp, Iss int64
+			}
+			if b, err := enc.DecodeString(parts[1]); err != nil || json.Unmarshal(b, &claims) != nil {
+				t.Fatalf("JWT() claims %q are not base64 JSON", parts[1])
+			}
+			if claims.Iss != testAppID {
+				t.Errorf("JWT() iss = %v, want %v", claims.Iss, testAppID)
+			}
+			// The JWT is issued in the past for the clock skew, and github
+			// rejects JWTs valid for more than 10 minutes.
+			if want := now - int64(clockSkew/time.Second); claims.Iat < want-1 || claims.Iat > want+1 {
+				t.Errorf("JWT() iat = %v, want %v", claims.Iat, want)
+			}
+			if d := time.Duration(claims.Exp-claims.Iat) * time.Second; d != jwtLifetime+clockSkew || d > 10*time.Minute {
+				t.Errorf("JWT() is valid for %v, want %v, and at most 10m", d, jwtLifetime+clockSkew)
+			}
+		})
+	}
+}
+
+func TestToken(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		lifetime time.Duration
+		refresh  bool
+	}{
+		{name: "valid", lifetime: time.Hour},
+		{name: "about to expire", lifetime: refreshBefore - time.Minute, refresh: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a, fake := newTestApp(t)
+			fake.AppTokenLifetime = tt.lifetime
+			first, err := a.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(first.AccessToken, "ghs_") {
+				t.Errorf("Token() = %q, want an installation token", first.AccessToken)
+			}
+			second, err := a.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refreshed := second.AccessToken != first.AccessToken; refreshed != tt.refresh {
+				t.Errorf("Token() for a token valid for %v: refreshed = %v, want %v", tt.lifetime, refreshed, tt.refresh)
+			}
+		})
+	}
+}
+
+func TestBotIdentity(t *testing.T) {
+	a, _ := newTestApp(t)
+	name, email, err := a.BotIdentity(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "release-bot[bot]"; name != want {
+		t.Errorf("BotIdentity() name = %q, want %q", name, want)
+	}
+	if want := "40001+release-bot[bot]@users.noreply.github.com"; email != want {
+		t.Errorf("BotIdentity() email = %q, want %q", email, want)
+	}
+}
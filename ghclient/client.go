@@ -4,8 +4,13 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/go-github/github"
+	"github.com/menghanl/release-git-bot/dryrun"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -15,15 +20,119 @@ type Client struct {
 	repo  string
 
 	c *github.Client
+
+	baseBranch string
+	dryRun     *dryrun.Recorder
+
+	concurrency int
+	maxRetries  int
+}
+
+// Config contains the settings to create a Client.
+type Config struct {
+	// HTTPClient is the client to send requests with. If nil,
+	// http.DefaultClient will be used.
+	HTTPClient *http.Client
+	// Owner is the owner's username on github.
+	Owner string
+	// Repo is the repo name.
+	Repo string
+	// BaseBranch is the branch new branches are created from. If empty,
+	// "master" will be used.
+	BaseBranch string
+	// BaseURL is the URL of the github API, e.g.
+	// "https://github.example.com/api/v3/" for GitHub Enterprise. If empty,
+	// the public github API will be used.
+	BaseURL string
+	// UploadURL is the upload URL of the github API. If empty and BaseURL is
+	// set, BaseURL with "/api/v3/" replaced by "/api/uploads/" will be used.
+	UploadURL string
+
+	// Concurrency is the max number of requests sent at the same time when
+	// fetching many things, e.g. the events of all PRs in a milestone. If 0,
+	// 8 will be used.
+	Concurrency int
+	// MaxRetries is the max number of retries for a request that hit the rate
+	// limit or failed with a server error. If 0, 5 will be used. If negative,
+	// requests are not retried.
+	MaxRetries int
+
+	// DryRun, if not nil, records the mutations (new branches, pull requests
+	// and releases) instead of making them. Queries are still sent to github.
+	DryRun *dryrun.Recorder
 }
 
 // New creates a new client.
 func New(tc *http.Client, owner, repo string) *Client {
+	// The config has no BaseURL, so there's no error.
+	c, _ := NewWithConfig(&Config{
+		HTTPClient: tc,
+		Owner:      owner,
+		Repo:       repo,
+	})
+	return c
+}
+
+// NewWithConfig creates a new client with the config.
+func NewWithConfig(c *Config) (*Client, error) {
+	baseBranch := c.BaseBranch
+	if baseBranch == "" {
+		baseBranch = "master"
+	}
+	gc := github.NewClient(c.HTTPClient)
+	if c.BaseURL != "" {
+		u, err := parseAPIURL(c.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base URL %q: %v", c.BaseURL, err)
+		}
+		gc.BaseURL = u
+		gc.UploadURL = u
+		if strings.HasSuffix(u.Path, "/api/v3/") {
+			uploadURL := *u
+			uploadURL.Path = strings.TrimSuffix(u.Path, "/api/v3/") + "/api/uploads/"
+			gc.UploadURL = &uploadURL
+		}
+	}
+	if c.UploadURL != "" {
+		u, err := parseAPIURL(c.UploadURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upload URL %q: %v", c.UploadURL, err)
+		}
+		gc.UploadURL = u
+	}
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	maxRetries := c.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	}
 	return &Client{
-		owner: owner,
-		repo:  repo,
-		c:     github.NewClient(tc),
+		owner:       c.Owner,
+		repo:        c.Repo,
+		c:           gc,
+		baseBranch:  baseBranch,
+		dryRun:      c.DryRun,
+		concurrency: concurrency,
+		maxRetries:  maxRetries,
+	}, nil
+}
+
+// parseAPIURL parses an API URL. A trailing slash is added if it's missing,
+// because the request paths are relative to it.
+func parseAPIURL(s string) (*url.URL, error) {
+	if !strings.HasSuffix(s, "/") {
+		s += "/"
 	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("missing scheme or host")
+	}
+	return u, nil
 }
 
 // Owner returns the github user name this client was build with.
@@ -38,67 +147,242 @@ func (c *Client) Repo() string {
 
 // GetMergedPRsForMilestone returns a list of github issues that are merged PRs
 // for this milestone.
-func (c *Client) GetMergedPRsForMilestone(milestone string) []*github.Issue {
-	return c.getMergedPRsForMilestone(milestone)
+//
+// It returns an error if the milestone doesn't exist.
+func (c *Client) GetMergedPRsForMilestone(ctx context.Context, milestone string) ([]*github.Issue, error) {
+	return c.getMergedPRsForMilestone(ctx, milestone)
 }
 
 // GetMergedPRsForLabels returns a list of github issues that are merged PRs
 // with the given label.
-func (c *Client) GetMergedPRsForLabels(labels []string) []*github.Issue {
-	return c.getMergedPRsForLabels(labels)
+func (c *Client) GetMergedPRsForLabels(ctx context.Context, labels []string) ([]*github.Issue, error) {
+	return c.getMergedPRsForLabels(ctx, labels)
+}
+
+// GetMergedPRsBetween returns a list of github issues that are merged PRs
+// with commits in the range base..head, e.g. from the previous tag to the
+// head of the release branch.
+//
+// The PRs are found from the "(#123)" suffix of squash merged and cherry
+// picked commits, and from "Merge pull request #123" merge commits.
+func (c *Client) GetMergedPRsBetween(ctx context.Context, base, head string) ([]*github.Issue, error) {
+	return c.getMergedPRsBetween(ctx, base, head)
+}
+
+// GetMergedPRsForCommits returns a list of github issues that are the merged
+// PRs associated with the commits in the range base..head.
+//
+// Unlike GetMergedPRsBetween, the PRs are found with github's commit to PR
+// association, so commits with any message are found.
+func (c *Client) GetMergedPRsForCommits(ctx context.Context, base, head string) ([]*github.Issue, error) {
+	return c.getMergedPRsForCommits(ctx, base, head)
+}
+
+// ListTags returns the names of all the tags in the repo.
+func (c *Client) ListTags(ctx context.Context) ([]string, error) {
+	return c.listTags(ctx)
+}
+
+// BranchExists returns whether the branch exists.
+func (c *Client) BranchExists(ctx context.Context, branchName string) (bool, error) {
+	resp, err := c.retry(ctx, func() (resp *github.Response, err error) {
+		_, resp, err = c.c.Git.GetRef(ctx, c.owner, c.repo, "heads/"+branchName)
+		return resp, err
+	})
+	if err == nil {
+		return true, nil
+	}
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return false, err
 }
 
 // GetOrgMembers returns a set of names of members in the org.
-func (c *Client) GetOrgMembers(org string) map[string]struct{} {
-	return c.getOrgMembers(org)
+func (c *Client) GetOrgMembers(ctx context.Context, org string) (map[string]struct{}, error) {
+	return c.getOrgMembers(ctx, org)
+}
+
+// MergeBase returns the SHA of the best common ancestor of base and head, e.g.
+// the commit a release branch was branched at.
+func (c *Client) MergeBase(ctx context.Context, base, head string) (string, error) {
+	return c.mergeBase(ctx, base, head)
+}
+
+// CommitDate returns the committer date of the commit ref points to, e.g. a
+// tag.
+func (c *Client) CommitDate(ctx context.Context, ref string) (time.Time, error) {
+	return c.commitDate(ctx, ref)
+}
+
+// FirstTimeContributors returns the set of the users in logins without any
+// merged PR in the repo before the time, e.g. the date of the previous
+// release.
+func (c *Client) FirstTimeContributors(ctx context.Context, logins []string, before time.Time) (map[string]bool, error) {
+	return c.firstTimeContributors(ctx, logins, before)
 }
 
 // CommitIDForMergedPR returns the commit id for pr.
 //
 // It returns "" if pr is not a merged PR.
-func (c *Client) CommitIDForMergedPR(pr *github.Issue) string {
-	return c.commitIDForMergedPR(pr)
+func (c *Client) CommitIDForMergedPR(ctx context.Context, pr *github.Issue) (string, error) {
+	return c.commitIDForMergedPR(ctx, pr)
+}
+
+// PRStatus contains the merge and CI status of a pull request.
+type PRStatus struct {
+	// Merged is true if the PR was merged.
+	Merged bool
+	// Closed is true if the PR was closed, merged or not.
+	Closed bool
+	// Checks contains the statuses and check runs on the PR's head commit.
+	Checks []*CheckStatus
+}
+
+// CheckStatus is the state of one CI status or check run.
+type CheckStatus struct {
+	Name string
+	// State is the status state ("pending", "success", "failure", "error"),
+	// or the check run conclusion if it's completed, or the check run status
+	// otherwise.
+	State string
+}
+
+// GetPRStatus returns the merge and CI status of the PR with the given number.
+func (c *Client) GetPRStatus(ctx context.Context, number int) (*PRStatus, error) {
+	return c.getPRStatus(ctx, number)
 }
 
-// NewBranchFromHead create a new branch with the current commit from head.
+// IsReleasePublished returns whether the release with the given tag is
+// published (not a draft anymore).
 //
-// It does nothing if the branch already exists.
-func (c *Client) NewBranchFromHead(branchName string) error {
+// It returns an error if there's no release for the tag.
+func (c *Client) IsReleasePublished(ctx context.Context, tagName string) (bool, error) {
+	release, err := c.getReleaseByTagName(ctx, tagName)
+	if err != nil {
+		return false, err
+	}
+	return !release.GetDraft(), nil
+}
+
+// PRNumberFromURL returns the PR number from a PR's HTML URL, for example 17
+// for https://github.com/grpc/grpc-go/pull/17.
+func PRNumberFromURL(prURL string) (int, error) {
+	i := strings.LastIndex(prURL, "/pull/")
+	if i < 0 {
+		return 0, fmt.Errorf("%q is not a pull request URL", prURL)
+	}
+	num, err := strconv.Atoi(strings.TrimSuffix(prURL[i+len("/pull/"):], "/"))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a pull request URL: %v", prURL, err)
+	}
+	return num, nil
+}
+
+// NewBranchFromHead create a new branch with the current commit from head of
+// the base branch, and returns the commit's SHA. In dry run, the branch is
+// only recorded, and the SHA is the commit it would be created at.
+//
+// It does nothing and returns "" if the branch already exists.
+func (c *Client) NewBranchFromHead(ctx context.Context, branchName string) (string, error) {
 	log.Infof("creating branch: %v/%v/%v", c.owner, c.repo, branchName)
-	ctx := context.Background()
 
 	refName := "heads/" + branchName
 	// Check if ref already exists.
-	if ref, _, err := c.c.Git.GetRef(ctx, c.owner, c.repo, refName); err == nil {
-		log.Infof("ref already exists: %v", ref)
-		return nil
+	exists, err := c.BranchExists(ctx, branchName)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if %v exists: %v", branchName, err)
+	}
+	if exists {
+		log.Infof("ref already exists: %v", refName)
+		return "", nil
 	}
 
 	// Get head SHA.
-	ref, _, err := c.c.Git.GetRef(ctx, c.owner, c.repo, "heads/master")
+	var ref *github.Reference
+	_, err = c.retry(ctx, func() (resp *github.Response, err error) {
+		ref, resp, err = c.c.Git.GetRef(ctx, c.owner, c.repo, "heads/"+c.baseBranch)
+		return resp, err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get master hash: %v", err)
+		return "", fmt.Errorf("failed to get %v hash: %v", c.baseBranch, err)
+	}
+	sha := ref.GetObject().GetSHA()
+	log.Infof("hash for HEAD: %v", sha)
+
+	if c.dryRun != nil {
+		c.dryRun.Record("CreateRef", fmt.Sprintf("create branch %v/%v/%v at %v", c.owner, c.repo, branchName, sha), "")
+		return sha, nil
 	}
-	log.Infof("hash for HEAD: %v", ref.GetObject().GetSHA())
 
 	// Create new ref.
-	newRef, _, err := c.c.Git.CreateRef(ctx, c.owner, c.repo, &github.Reference{
-		Ref:    &refName,
-		Object: ref.GetObject(),
+	var newRef *github.Reference
+	_, err = c.retry(ctx, func() (resp *github.Response, err error) {
+		newRef, resp, err = c.c.Git.CreateRef(ctx, c.owner, c.repo, &github.Reference{
+			Ref:    &refName,
+			Object: ref.GetObject(),
+		})
+		return resp, err
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create ref: %v", err)
+		return "", fmt.Errorf("failed to create ref: %v", err)
 	}
 
 	log.Infof("new ref created: %v", newRef.String())
+	return sha, nil
+}
+
+// SyncFork fast-forwards the branch of forkOwner's fork to the upstream
+// branch with the same name. It fails if the fork's branch has commits that
+// upstream doesn't have.
+func (c *Client) SyncFork(ctx context.Context, forkOwner, branchName string) error {
+	refName := "heads/" + branchName
+	var upstreamRef, forkRef *github.Reference
+	_, err := c.retry(ctx, func() (resp *github.Response, err error) {
+		upstreamRef, resp, err = c.c.Git.GetRef(ctx, c.owner, c.repo, refName)
+		return resp, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get %v/%v/%v hash: %v", c.owner, c.repo, branchName, err)
+	}
+	_, err = c.retry(ctx, func() (resp *github.Response, err error) {
+		forkRef, resp, err = c.c.Git.GetRef(ctx, forkOwner, c.repo, refName)
+		return resp, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get %v/%v/%v hash: %v", forkOwner, c.repo, branchName, err)
+	}
+	sha := upstreamRef.GetObject().GetSHA()
+	if forkRef.GetObject().GetSHA() == sha {
+		log.Infof("fork is up-to-date: %v/%v/%v at %v", forkOwner, c.repo, branchName, sha)
+		return nil
+	}
+
+	if c.dryRun != nil {
+		c.dryRun.Record("UpdateRef", fmt.Sprintf("fast-forward branch %v/%v/%v to %v", forkOwner, c.repo, branchName, sha), "")
+		return nil
+	}
+
+	_, err = c.retry(ctx, func() (resp *github.Response, err error) {
+		_, resp, err = c.c.Git.UpdateRef(ctx, forkOwner, c.repo, &github.Reference{
+			Ref:    &refName,
+			Object: &github.GitObject{SHA: &sha},
+		}, false)
+		return resp, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fast-forward %v/%v/%v to %v, does it have commits that are not in upstream? %v", forkOwner, c.repo, branchName, sha, err)
+	}
+	log.Infof("fork fast-forwarded: %v/%v/%v to %v", forkOwner, c.repo, branchName, sha)
 	return nil
 }
 
 // NewPullRequest creates a pull request to the owner/repo pointed by this
-// Client.
+// Client. If there's already an open pull request from the head to base, e.g.
+// from an earlier run of a failed step, its URL is returned instead.
 //
 // headUser:headBranch specifies where the pull request is from.
-func (c *Client) NewPullRequest(headUser, headBranch, base, title, body string) (string, error) {
+func (c *Client) NewPullRequest(ctx context.Context, headUser, headBranch, base, title, body string) (string, error) {
 	newPR := &github.NewPullRequest{
 		Title:               github.String(title),
 		Head:                github.String(headUser + ":" + headBranch),
@@ -107,7 +391,24 @@ func (c *Client) NewPullRequest(headUser, headBranch, base, title, body string)
 		MaintainerCanModify: github.Bool(true),
 	}
 
-	pr, _, err := c.c.PullRequests.Create(context.Background(), c.owner, c.repo, newPR)
+	if c.dryRun != nil {
+		summary := fmt.Sprintf("create pull request %q from %v:%v to %v/%v/%v", title, headUser, headBranch, c.owner, c.repo, base)
+		c.dryRun.Record("PullRequests.Create", summary, body)
+		return fmt.Sprintf("(dry run) %v:%v -> %v", headUser, headBranch, base), nil
+	}
+
+	pr, err := c.findOpenPR(ctx, newPR.GetHead(), base)
+	if err != nil {
+		return "", err
+	}
+	if pr != nil {
+		log.Infof("PR already exists: %s", pr.GetHTMLURL())
+		return pr.GetHTMLURL(), nil
+	}
+	_, err = c.retry(ctx, func() (resp *github.Response, err error) {
+		pr, resp, err = c.c.PullRequests.Create(ctx, c.owner, c.repo, newPR)
+		return resp, err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -116,15 +417,57 @@ func (c *Client) NewPullRequest(headUser, headBranch, base, title, body string)
 }
 
 // NewDraftRelease creates a draft release.
-func (c *Client) NewDraftRelease(tagName, targetBranch, title, body string) (string, error) {
+func (c *Client) NewDraftRelease(ctx context.Context, tagName, targetBranch, title, body string) (string, error) {
+	return c.newDraftRelease(ctx, tagName, targetBranch, title, body, false)
+}
+
+// NewDraftPrerelease creates a draft release that is marked as a pre-release,
+// e.g. for a release candidate.
+func (c *Client) NewDraftPrerelease(ctx context.Context, tagName, targetBranch, title, body string) (string, error) {
+	return c.newDraftRelease(ctx, tagName, targetBranch, title, body, true)
+}
+
+// newDraftRelease creates the draft release. If there's already a draft
+// release for the tag, e.g. from an earlier run of a failed step, it's updated
+// instead. If the release is already published, it's left as is.
+func (c *Client) newDraftRelease(ctx context.Context, tagName, targetBranch, title, body string, prerelease bool) (string, error) {
 	newRelease := &github.RepositoryRelease{
 		TagName:         github.String(tagName),
 		TargetCommitish: github.String(targetBranch),
 		Name:            github.String(title),
 		Body:            github.String(body),
 		Draft:           github.Bool(true),
+		Prerelease:      github.Bool(prerelease),
+	}
+	if c.dryRun != nil {
+		kind := "release"
+		if prerelease {
+			kind = "pre-release"
+		}
+		summary := fmt.Sprintf("create draft %v %q with tag %v on %v/%v/%v", kind, title, tagName, c.owner, c.repo, targetBranch)
+		c.dryRun.Record("CreateRelease", summary, body)
+		return fmt.Sprintf("(dry run) release %v", tagName), nil
+	}
+	release, err := c.findReleaseByTagName(ctx, tagName)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case release == nil:
+		_, err = c.retry(ctx, func() (resp *github.Response, err error) {
+			release, resp, err = c.c.Repositories.CreateRelease(ctx, c.owner, c.repo, newRelease)
+			return resp, err
+		})
+	case release.GetDraft():
+		log.Infof("draft release already exists, updating: %s", release.GetHTMLURL())
+		id := release.GetID()
+		_, err = c.retry(ctx, func() (resp *github.Response, err error) {
+			release, resp, err = c.c.Repositories.EditRelease(ctx, c.owner, c.repo, id, newRelease)
+			return resp, err
+		})
+	default:
+		log.Infof("release already published: %s", release.GetHTMLURL())
 	}
-	release, _, err := c.c.Repositories.CreateRelease(context.Background(), c.owner, c.repo, newRelease)
 	if err != nil {
 		return "", err
 	}
@@ -132,8 +475,12 @@ func (c *Client) NewDraftRelease(tagName, targetBranch, title, body string) (str
 }
 
 // GetPrimaryEmail returns the primary email of the token owner.
-func (c *Client) GetPrimaryEmail() (string, error) {
-	emails, _, err := c.c.Users.ListEmails(context.Background(), nil)
+func (c *Client) GetPrimaryEmail(ctx context.Context) (string, error) {
+	var emails []*github.UserEmail
+	_, err := c.retry(ctx, func() (resp *github.Response, err error) {
+		emails, resp, err = c.c.Users.ListEmails(ctx, nil)
+		return resp, err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -151,9 +498,13 @@ func (c *Client) GetPrimaryEmail() (string, error) {
 }
 
 // GetLogin returns the username of the token owner.
-func (c *Client) GetLogin() (string, error) {
+func (c *Client) GetLogin(ctx context.Context) (string, error) {
 	// Passing the empty string will fetch the authenticated user.
-	user, _, err := c.c.Users.Get(context.Background(), "")
+	var user *github.User
+	_, err := c.retry(ctx, func() (resp *github.Response, err error) {
+		user, resp, err = c.c.Users.Get(ctx, "")
+		return resp, err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -3,133 +3,437 @@ package ghclient
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strconv"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/google/go-github/github"
 	log "github.com/sirupsen/logrus"
 )
 
-func (c *Client) getMilestoneNumberForTitle(ctx context.Context, milestoneTitle string) (int, error) {
+// getMilestoneForTitle finds the milestone with the title, open or closed.
+func (c *Client) getMilestoneForTitle(ctx context.Context, milestoneTitle string) (*github.Milestone, error) {
 	log.Info("milestone title: ", milestoneTitle)
-	milestones, _, err := c.c.Issues.ListMilestones(context.Background(), c.owner, c.repo,
-		&github.MilestoneListOptions{
-			State:       "all",
-			ListOptions: github.ListOptions{PerPage: 100},
-		},
-	)
-	if err != nil {
-		return 0, err
+	opt := &github.MilestoneListOptions{
+		State:       "all",
+		ListOptions: github.ListOptions{PerPage: 100},
 	}
-	log.Info("count milestones", len(milestones))
-	for _, m := range milestones {
-		if m.GetTitle() == milestoneTitle {
-			return m.GetNumber(), nil
+	var count int
+	for {
+		var milestones []*github.Milestone
+		resp, err := c.retry(ctx, func() (resp *github.Response, err error) {
+			milestones, resp, err = c.c.Issues.ListMilestones(ctx, c.owner, c.repo, opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range milestones {
+			if m.GetTitle() == milestoneTitle {
+				return m, nil
+			}
+		}
+		count += len(milestones)
+		if resp.NextPage == 0 {
+			break
 		}
+		opt.Page = resp.NextPage
 	}
-	return 0, fmt.Errorf("no milestone with title %q was found", milestoneTitle)
+	log.Info("count milestones", count)
+	return nil, fmt.Errorf("no milestone with title %q was found", milestoneTitle)
 }
 
-func (c *Client) getMergeEventForPR(ctx context.Context, issue *github.Issue) (*github.IssueEvent, error) {
-	events, _, err := c.c.Issues.ListIssueEvents(ctx, c.owner, c.repo, issue.GetNumber(), &github.ListOptions{PerPage: 1000})
-	if err != nil {
-		return nil, err
-	}
-	for _, e := range events {
-		if e.GetEvent() == "merged" {
-			return e, nil
+// listIssues returns the issues and PRs on all the pages for opt.
+func (c *Client) listIssues(ctx context.Context, opt *github.IssueListByRepoOptions) ([]*github.Issue, error) {
+	opt.PerPage = 100
+	var ret []*github.Issue
+	for {
+		var issues []*github.Issue
+		resp, err := c.retry(ctx, func() (resp *github.Response, err error) {
+			issues, resp, err = c.c.Issues.ListByRepo(ctx, c.owner, c.repo, opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
 		}
+		ret = append(ret, issues...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
 	}
-	return nil, fmt.Errorf("merge event not found")
+	return ret, nil
 }
 
-func (c *Client) getMergedPRs(issues []*github.Issue) (prs []*github.Issue) {
-	ctx := context.Background()
-
-	prChan := make(chan *github.Issue)
+// getMergeEventForPR returns the merged event of the PR, or nil if the PR
+// wasn't merged.
+func (c *Client) getMergeEventForPR(ctx context.Context, issue *github.Issue) (*github.IssueEvent, error) {
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		var events []*github.IssueEvent
+		resp, err := c.retry(ctx, func() (resp *github.Response, err error) {
+			events, resp, err = c.c.Issues.ListIssueEvents(ctx, c.owner, c.repo, issue.GetNumber(), opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			if e.GetEvent() == "merged" {
+				return e, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return nil, nil
+}
 
-	var wg sync.WaitGroup
+// getMergedPRs returns the merged PRs in issues, in the same order. The merge
+// events are fetched with at most c.concurrency requests at the same time.
+func (c *Client) getMergedPRs(ctx context.Context, issues []*github.Issue) ([]*github.Issue, error) {
+	var candidates []*github.Issue
 	for _, ii := range issues {
 		if ii.PullRequestLinks == nil {
 			log.Infof("%v not a pull request", issueToString(ii))
 			continue
 		}
-		wg.Add(1)
-		go func(ii *github.Issue) {
-			defer wg.Done()
-			// ii is a PR.
-			_, err := c.getMergeEventForPR(ctx, ii)
-			if err != nil {
-				log.Infof("failed to get merge event, issue: %v, error: %v", issueToString(ii), err)
-				return
-			}
-			prChan <- ii
-		}(ii)
+		candidates = append(candidates, ii)
+	}
+
+	merged := make([]bool, len(candidates))
+	if err := c.forEach(ctx, len(candidates), func(ctx context.Context, i int) error {
+		// ii is a PR.
+		ii := candidates[i]
+		e, err := c.getMergeEventForPR(ctx, ii)
+		if err != nil {
+			return fmt.Errorf("failed to get merge event of %v: %v", issueToString(ii), err)
+		}
+		if e == nil {
+			log.Infof("%v was closed without merging", issueToString(ii))
+			return nil
+		}
+		merged[i] = true
+		return nil
+	}); err != nil {
+		return nil, err
 	}
-	go func() {
-		wg.Wait()
-		close(prChan)
-	}()
 
-	for ii := range prChan {
+	var prs []*github.Issue
+	for i, ii := range candidates {
+		if !merged[i] {
+			continue
+		}
 		log.Info(issueToString(ii))
 		log.Info(" - ", labelsToString(ii.Labels))
 		prs = append(prs, ii)
 	}
-	return
+	return prs, nil
 }
 
-func (c *Client) getMergedPRsForMilestone(milestoneTitle string) []*github.Issue {
-	num, err := c.getMilestoneNumberForTitle(context.Background(), milestoneTitle)
+func (c *Client) getMergedPRsForMilestone(ctx context.Context, milestoneTitle string) ([]*github.Issue, error) {
+	m, err := c.getMilestoneForTitle(ctx, milestoneTitle)
 	if err != nil {
-		log.Info("failed to get milestone number: ", err)
+		return nil, fmt.Errorf("failed to get milestone: %v", err)
 	}
 
 	// Get closed issues with milestone number.
-	milestoneNumberStr := strconv.Itoa(num)
+	milestoneNumberStr := strconv.Itoa(m.GetNumber())
 	log.Info("milestone number: ", milestoneNumberStr)
-	issues, _, err := c.c.Issues.ListByRepo(context.Background(), c.owner, c.repo,
-		&github.IssueListByRepoOptions{
-			State:       "closed",
-			Milestone:   milestoneNumberStr,
-			ListOptions: github.ListOptions{PerPage: 1000},
-		},
-	)
-	if err != nil {
-		log.Info("failed to get closed issues for milestone: ", err)
-		return nil
+	issues, err := c.listIssues(ctx, &github.IssueListByRepoOptions{
+		State:     "closed",
+		Milestone: milestoneNumberStr,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get closed issues for milestone %q: %v", milestoneTitle, err)
 	}
 	log.Info("count issues", len(issues))
-	return c.getMergedPRs(issues)
+	if len(issues) != m.GetClosedIssues() {
+		log.Warningf("milestone %q has %v closed issues, but %v were listed", milestoneTitle, m.GetClosedIssues(), len(issues))
+	}
+	prs, err := c.getMergedPRs(ctx, issues)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("milestone %q: %v closed issues, %v merged PRs", milestoneTitle, len(issues), len(prs))
+	return prs, nil
 }
 
-func (c *Client) getMergedPRsForLabels(labels []string) []*github.Issue {
+func (c *Client) getMergedPRsForLabels(ctx context.Context, labels []string) ([]*github.Issue, error) {
 	// Get closed issues with labels.
 	log.Info("labels: ", labels)
-	issues, _, err := c.c.Issues.ListByRepo(context.Background(), c.owner, c.repo,
-		&github.IssueListByRepoOptions{
-			State:       "closed",
-			Labels:      labels,
-			ListOptions: github.ListOptions{PerPage: 1000},
-		},
-	)
-	if err != nil {
-		log.Info("failed to get closed issues for milestone: ", err)
+	issues, err := c.listIssues(ctx, &github.IssueListByRepoOptions{
+		State:  "closed",
+		Labels: labels,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get closed issues for labels %v: %v", labels, err)
+	}
+	log.Info("count issues", len(issues))
+	prs, err := c.getMergedPRs(ctx, issues)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("labels %v: %v closed issues, %v merged PRs", labels, len(issues), len(prs))
+	return prs, nil
+}
+
+var (
+	squashedPRNumberRegex = regexp.MustCompile(`\(#(\d+)\)\s*$`)
+	mergedPRNumberRegex   = regexp.MustCompile(`^Merge pull request #(\d+)`)
+)
+
+// prNumberFromCommitMessage returns the PR number in the first line of the
+// commit message, or 0 if there's none.
+func prNumberFromCommitMessage(msg string) int {
+	firstLine := strings.SplitN(msg, "\n", 2)[0]
+	for _, re := range []*regexp.Regexp{squashedPRNumberRegex, mergedPRNumberRegex} {
+		if m := re.FindStringSubmatch(firstLine); m != nil {
+			num, _ := strconv.Atoi(m[1])
+			return num
+		}
+	}
+	return 0
+}
+
+// compareCommits returns the commits in base...head, oldest first.
+//
+// A comparison has at most 250 commits. If there are more, the commits of head
+// are listed back to the merge base instead.
+func (c *Client) compareCommits(ctx context.Context, base, head string) ([]github.RepositoryCommit, error) {
+	log.Infof("comparing %v...%v", base, head)
+	var comparison *github.CommitsComparison
+	_, err := c.retry(ctx, func() (resp *github.Response, err error) {
+		comparison, resp, err = c.c.Repositories.CompareCommits(ctx, c.owner, c.repo, base, head)
+		return resp, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare %v...%v: %v", base, head, err)
+	}
+	total := comparison.GetTotalCommits()
+	if total <= len(comparison.Commits) {
+		return comparison.Commits, nil
+	}
+	log.Infof("%v...%v has %v commits, more than the %v in the comparison, listing them", base, head, total, len(comparison.Commits))
+	mergeBase := comparison.GetMergeBaseCommit().GetSHA()
+	commits, err := c.listCommitsUntil(ctx, head, mergeBase, total)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) != total {
+		return nil, fmt.Errorf("%v...%v has %v commits, but %v were listed from %v to the merge base %v", base, head, total, len(commits), head, mergeBase)
+	}
+	return commits, nil
+}
+
+func (c *Client) mergeBase(ctx context.Context, base, head string) (string, error) {
+	var comparison *github.CommitsComparison
+	if _, err := c.retry(ctx, func() (resp *github.Response, err error) {
+		comparison, resp, err = c.c.Repositories.CompareCommits(ctx, c.owner, c.repo, base, head)
+		return resp, err
+	}); err != nil {
+		return "", fmt.Errorf("failed to compare %v...%v: %v", base, head, err)
+	}
+	sha := comparison.GetMergeBaseCommit().GetSHA()
+	if sha == "" {
+		return "", fmt.Errorf("%v and %v have no merge base", base, head)
+	}
+	return sha, nil
+}
+
+// listCommitsUntil lists the commits of head until the commit stop, and
+// returns them oldest first. It stops with an error after max commits.
+func (c *Client) listCommitsUntil(ctx context.Context, head, stop string, max int) ([]github.RepositoryCommit, error) {
+	opt := &github.CommitsListOptions{
+		SHA:         head,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	var ret []github.RepositoryCommit
+	for {
+		var commits []*github.RepositoryCommit
+		resp, err := c.retry(ctx, func() (resp *github.Response, err error) {
+			commits, resp, err = c.c.Repositories.ListCommits(ctx, c.owner, c.repo, opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list commits of %v: %v", head, err)
+		}
+		for _, cmt := range commits {
+			if cmt.GetSHA() == stop {
+				return reverseCommits(ret), nil
+			}
+			if len(ret) == max {
+				return nil, fmt.Errorf("more than %v commits of %v before %v", max, head, stop)
+			}
+			ret = append(ret, *cmt)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return nil, fmt.Errorf("%v was not found in the commits of %v", stop, head)
+}
+
+func reverseCommits(commits []github.RepositoryCommit) []github.RepositoryCommit {
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+	return commits
+}
+
+// getIssues gets the issues or PRs with the numbers, in the same order.
+func (c *Client) getIssues(ctx context.Context, nums []int) ([]*github.Issue, error) {
+	issues := make([]*github.Issue, len(nums))
+	if err := c.forEach(ctx, len(nums), func(ctx context.Context, i int) error {
+		_, err := c.retry(ctx, func() (resp *github.Response, err error) {
+			issues[i], resp, err = c.c.Issues.Get(ctx, c.owner, c.repo, nums[i])
+			return resp, err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get PR %v: %v", nums[i], err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
+
+func (c *Client) getMergedPRsBetween(ctx context.Context, base, head string) ([]*github.Issue, error) {
+	commits, err := c.compareCommits(ctx, base, head)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	var nums []int
+	for _, cmt := range commits {
+		num := prNumberFromCommitMessage(cmt.GetCommit().GetMessage())
+		if num == 0 {
+			log.Infof("no PR found for commit %v", cmt.GetSHA())
+			continue
+		}
+		if seen[num] {
+			continue
+		}
+		seen[num] = true
+		nums = append(nums, num)
+	}
+	issues, err := c.getIssues(ctx, nums)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("count issues", len(issues))
+	return c.getMergedPRs(ctx, issues)
+}
+
+// listPRsForCommit returns the PRs associated with the commit, e.g. the PR
+// that merged it. go-github doesn't have this API, it was in preview.
+func (c *Client) listPRsForCommit(ctx context.Context, sha string) ([]*github.PullRequest, error) {
+	u := fmt.Sprintf("repos/%v/%v/commits/%v/pulls?per_page=100", c.owner, c.repo, sha)
+	var prs []*github.PullRequest
+	_, err := c.retry(ctx, func() (*github.Response, error) {
+		req, err := c.c.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github.groot-preview+json")
+		prs = nil
+		return c.c.Do(ctx, req, &prs)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PRs for commit %v: %v", sha, err)
+	}
+	return prs, nil
+}
+
+func (c *Client) getMergedPRsForCommits(ctx context.Context, base, head string) ([]*github.Issue, error) {
+	commits, err := c.compareCommits(ctx, base, head)
+	if err != nil {
+		return nil, err
+	}
+
+	// The merged PRs of each commit, in the order of the commits.
+	commitPRs := make([][]int, len(commits))
+	if err := c.forEach(ctx, len(commits), func(ctx context.Context, i int) error {
+		prs, err := c.listPRsForCommit(ctx, commits[i].GetSHA())
+		if err != nil {
+			return err
+		}
+		for _, pr := range prs {
+			// Open PRs that contain the commit are also associated.
+			if pr.MergedAt != nil {
+				commitPRs[i] = append(commitPRs[i], pr.GetNumber())
+			}
+		}
 		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	var nums []int
+	for i, prs := range commitPRs {
+		if len(prs) == 0 {
+			log.Infof("no merged PR found for commit %v", commits[i].GetSHA())
+			continue
+		}
+		for _, num := range prs {
+			if !seen[num] {
+				seen[num] = true
+				nums = append(nums, num)
+			}
+		}
+	}
+	issues, err := c.getIssues(ctx, nums)
+	if err != nil {
+		return nil, err
 	}
 	log.Info("count issues", len(issues))
-	return c.getMergedPRs(issues)
+	return issues, nil
+}
+
+func (c *Client) listTags(ctx context.Context) ([]string, error) {
+	opt := &github.ListOptions{PerPage: 100}
+	var ret []string
+	for {
+		var tags []*github.RepositoryTag
+		resp, err := c.retry(ctx, func() (resp *github.Response, err error) {
+			tags, resp, err = c.c.Repositories.ListTags(ctx, c.owner, c.repo, opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %v", err)
+		}
+		for _, t := range tags {
+			ret = append(ret, t.GetName())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return ret, nil
 }
 
-func (c *Client) getOrgMembers(org string) map[string]struct{} {
-	opt := &github.ListMembersOptions{}
+func (c *Client) getOrgMembers(ctx context.Context, org string) (map[string]struct{}, error) {
+	opt := &github.ListMembersOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
 	var count int
 	ret := make(map[string]struct{})
 	for {
-		members, resp, err := c.c.Organizations.ListMembers(context.Background(), org, opt)
+		var members []*github.User
+		resp, err := c.retry(ctx, func() (resp *github.Response, err error) {
+			members, resp, err = c.c.Organizations.ListMembers(ctx, org, opt)
+			return resp, err
+		})
 		if err != nil {
-			log.Info("failed to get org members: ", err)
-			return nil
+			return nil, fmt.Errorf("failed to get members of org %v: %v", org, err)
 		}
 		for _, m := range members {
 			ret[m.GetLogin()] = struct{}{}
@@ -140,21 +444,174 @@ func (c *Client) getOrgMembers(org string) map[string]struct{} {
 		}
 		opt.Page = resp.NextPage
 	}
-	log.Infof("%v members in org %v\n", count, org)
-	return ret
+	log.Infof("%v members in org %v", count, org)
+	return ret, nil
+}
+
+func (c *Client) commitDate(ctx context.Context, ref string) (time.Time, error) {
+	var commit *github.RepositoryCommit
+	if _, err := c.retry(ctx, func() (resp *github.Response, err error) {
+		commit, resp, err = c.c.Repositories.GetCommit(ctx, c.owner, c.repo, ref)
+		return resp, err
+	}); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get commit %v: %v", ref, err)
+	}
+	return commit.GetCommit().GetCommitter().GetDate(), nil
+}
+
+// firstTimeContributors searches the merged PRs of each user before the time.
+// Only the count is needed, so one result is asked for.
+func (c *Client) firstTimeContributors(ctx context.Context, logins []string, before time.Time) (map[string]bool, error) {
+	isNew := make([]bool, len(logins))
+	if err := c.forEach(ctx, len(logins), func(ctx context.Context, i int) error {
+		query := fmt.Sprintf("repo:%v/%v is:pr is:merged author:%v merged:<%v", c.owner, c.repo, logins[i], before.UTC().Format(time.RFC3339))
+		var result *github.IssuesSearchResult
+		if _, err := c.retry(ctx, func() (resp *github.Response, err error) {
+			result, resp, err = c.c.Search.Issues(ctx, query, &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 1}})
+			return resp, err
+		}); err != nil {
+			return fmt.Errorf("failed to search merged PRs of %v: %v", logins[i], err)
+		}
+		isNew[i] = result.GetTotal() == 0
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	ret := make(map[string]bool)
+	for i, login := range logins {
+		if isNew[i] {
+			ret[login] = true
+		}
+	}
+	log.Infof("%v of %v contributors are new", len(ret), len(logins))
+	return ret, nil
 }
 
-func (c *Client) commitIDForMergedPR(pr *github.Issue) string {
-	ctx := context.Background()
+func (c *Client) commitIDForMergedPR(ctx context.Context, pr *github.Issue) (string, error) {
 	mergeEvent, err := c.getMergeEventForPR(ctx, pr)
 	if err != nil {
-		log.Info("failed to get merge event: ", err)
-		return ""
+		return "", fmt.Errorf("failed to get merge event: %v", err)
+	}
+	return mergeEvent.GetCommitID(), nil
+}
+
+func (c *Client) getPRStatus(ctx context.Context, number int) (*PRStatus, error) {
+	var pr *github.PullRequest
+	_, err := c.retry(ctx, func() (resp *github.Response, err error) {
+		pr, resp, err = c.c.PullRequests.Get(ctx, c.owner, c.repo, number)
+		return resp, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PR %v: %v", number, err)
+	}
+	ret := &PRStatus{
+		Merged: pr.GetMerged(),
+		Closed: pr.GetState() == "closed",
+	}
+
+	sha := pr.GetHead().GetSHA()
+	statusOpt := &github.ListOptions{PerPage: 100}
+	for {
+		var combined *github.CombinedStatus
+		resp, err := c.retry(ctx, func() (resp *github.Response, err error) {
+			combined, resp, err = c.c.Repositories.GetCombinedStatus(ctx, c.owner, c.repo, sha, statusOpt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get combined status for %v: %v", sha, err)
+		}
+		for _, s := range combined.Statuses {
+			ret.Checks = append(ret.Checks, &CheckStatus{Name: s.GetContext(), State: s.GetState()})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		statusOpt.Page = resp.NextPage
+	}
+	checkOpt := &github.ListCheckRunsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		var checkRuns *github.ListCheckRunsResults
+		resp, err := c.retry(ctx, func() (resp *github.Response, err error) {
+			checkRuns, resp, err = c.c.Checks.ListCheckRunsForRef(ctx, c.owner, c.repo, sha, checkOpt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get check runs for %v: %v", sha, err)
+		}
+		for _, r := range checkRuns.CheckRuns {
+			state := r.GetStatus()
+			if state == "completed" {
+				state = r.GetConclusion()
+			}
+			ret.Checks = append(ret.Checks, &CheckStatus{Name: r.GetName(), State: state})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		checkOpt.Page = resp.NextPage
+	}
+	return ret, nil
+}
+
+// getReleaseByTagName finds the release for the tag.
+func (c *Client) getReleaseByTagName(ctx context.Context, tagName string) (*github.RepositoryRelease, error) {
+	release, err := c.findReleaseByTagName(ctx, tagName)
+	if err != nil {
+		return nil, err
+	}
+	if release == nil {
+		return nil, fmt.Errorf("no release with tag %q was found", tagName)
+	}
+	return release, nil
+}
+
+// findReleaseByTagName returns the release for the tag, or nil if there's
+// none. It lists all releases instead of getting by tag, because draft
+// releases can't be found by tag.
+func (c *Client) findReleaseByTagName(ctx context.Context, tagName string) (*github.RepositoryRelease, error) {
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		var releases []*github.RepositoryRelease
+		resp, err := c.retry(ctx, func() (resp *github.Response, err error) {
+			releases, resp, err = c.c.Repositories.ListReleases(ctx, c.owner, c.repo, opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list releases: %v", err)
+		}
+		for _, r := range releases {
+			if r.GetTagName() == tagName {
+				return r, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return nil, nil
+}
+
+// findOpenPR returns the open PR from head, in the form user:branch, to base,
+// or nil if there's none.
+func (c *Client) findOpenPR(ctx context.Context, head, base string) (*github.PullRequest, error) {
+	opt := &github.PullRequestListOptions{
+		State: "open",
+		Head:  head,
+		Base:  base,
+	}
+	var prs []*github.PullRequest
+	_, err := c.retry(ctx, func() (resp *github.Response, err error) {
+		prs, resp, err = c.c.PullRequests.List(ctx, c.owner, c.repo, opt)
+		return resp, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pull requests from %v: %v", head, err)
+	}
+	if len(prs) == 0 {
+		return nil, nil
 	}
-	// cmt, _, err := c.c.Repositories.GetCommit(ctx, c.owner, c.repo, mergeEvent.GetCommitID())
-	// if err != nil {
-	// 	log.Info("failed to get commit: ", err)
-	// 	return ""
-	// }
-	return mergeEvent.GetCommitID()
+	return prs[0], nil
 }
@@ -0,0 +1,72 @@
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/menghanl/release-git-bot/internal/fakegithub"
+)
+
+// TestMergedPRsForManyCommits checks that the PRs of all the commits are found
+// when there are more commits than a comparison returns.
+func TestMergedPRsForManyCommits(t *testing.T) {
+	const n = 260
+
+	fake, err := fakegithub.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+	if err := fake.CreateRepo("grpc", "grpc-go", map[string]string{"version.go": "package grpc\n"}); err != nil {
+		t.Fatal(err)
+	}
+	base, err := fake.Commit("grpc", "grpc-go", "master", "Base", map[string]string{"base.go": "package grpc\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []int
+	for i := 0; i < n; i++ {
+		num, err := fake.AddPR("grpc", "grpc-go", &fakegithub.PR{Title: fmt.Sprintf("Change %v", i), Author: "gopher", Merged: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sha, err := fake.Commit("grpc", "grpc-go", "master", fmt.Sprintf("Change %v (#%v)", i, num), map[string]string{fmt.Sprintf("change%v.go", i): "package grpc\n"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fake.SetMergeCommit("grpc", "grpc-go", num, sha); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, num)
+	}
+
+	c, err := NewWithConfig(&Config{Owner: "grpc", Repo: "grpc-go", BaseURL: fake.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name string
+		get  func(ctx context.Context, base, head string) ([]*github.Issue, error)
+	}{
+		{name: "GetMergedPRsBetween", get: c.GetMergedPRsBetween},
+		{name: "GetMergedPRsForCommits", get: c.GetMergedPRsForCommits},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			prs, err := tt.get(ctx, base, "master")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, pr := range prs {
+				got = append(got, pr.GetNumber())
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v PRs %v, want %v PRs %v", len(got), got, len(want), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultConcurrency = 8
+	defaultMaxRetries  = 5
+
+	// The backoff for server errors, doubled after every retry.
+	initialBackoff = time.Second
+	maxBackoff     = time.Minute
+	// abuseBackoff is the wait after an abuse rate limit error without
+	// Retry-After.
+	abuseBackoff = time.Minute
+)
+
+// timeNow and timeAfter are time.Now and time.After, replaced by the tests so
+// they don't wait.
+var (
+	timeNow   = time.Now
+	timeAfter = time.After
+)
+
+// retry calls call until it succeeds, or returns an error that shouldn't be
+// retried, or fails c.maxRetries times. It returns the last response and
+// error from call.
+//
+// Rate limit errors are retried after the rate limit resets, and abuse rate
+// limit errors after Retry-After. Server errors (5xx) are retried with
+// exponential backoff, but only for GET requests, because other requests may
+// have been applied before failing.
+func (c *Client) retry(ctx context.Context, call func() (*github.Response, error)) (*github.Response, error) {
+	backoff := initialBackoff
+	for i := 0; ; i++ {
+		resp, err := call()
+		if err == nil || i >= c.maxRetries {
+			return resp, err
+		}
+		wait, ok := retryAfter(err, backoff)
+		if !ok {
+			return resp, err
+		}
+		log.Warningf("github request failed, retrying in %v: %v", wait, err)
+		select {
+		case <-timeAfter(wait):
+		case <-ctx.Done():
+			return resp, fmt.Errorf("%v, canceled while waiting to retry: %v", err, ctx.Err())
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// retryAfter returns how long to wait before retrying the request that failed
+// with err, or false if it shouldn't be retried. backoff is the wait for
+// server errors.
+func retryAfter(err error, backoff time.Duration) (time.Duration, bool) {
+	switch e := err.(type) {
+	case *github.RateLimitError:
+		// Wait one more second, in case the clocks don't agree.
+		return e.Rate.Reset.Time.Sub(timeNow()) + time.Second, true
+	case *github.AbuseRateLimitError:
+		if e.RetryAfter != nil {
+			return *e.RetryAfter, true
+		}
+		return abuseBackoff, true
+	case *github.ErrorResponse:
+		resp := e.Response
+		if resp == nil {
+			return 0, false
+		}
+		// Secondary rate limits that go-github doesn't recognize as abuse
+		// rate limits still have Retry-After.
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+			if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				return time.Duration(secs) * time.Second, true
+			}
+			return 0, false
+		}
+		if resp.StatusCode >= 500 && resp.Request != nil && resp.Request.Method == http.MethodGet {
+			return backoff, true
+		}
+	}
+	return 0, false
+}
+
+// forEach calls f with every index in [0, n), with at most c.concurrency
+// calls at the same time. It returns after all calls return.
+//
+// If a call returns an error, the indexes not started yet are skipped, and the
+// first error is returned. The ctx passed to f is canceled after the first
+// error.
+func (c *Client) forEach(ctx context.Context, n int, f func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	errs := make(chan error, n)
+	workers := c.concurrency
+	if workers > n {
+		workers = n
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := f(ctx, i); err != nil {
+					errs <- err
+					cancel()
+				}
+			}
+		}()
+	}
+loop:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,270 @@
+package ghclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+var testNow = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// stubTime makes timeNow return testNow, and timeAfter fire right away. The
+// waits are appended to the returned slice.
+func stubTime(t *testing.T) *[]time.Duration {
+	oldNow, oldAfter := timeNow, timeAfter
+	t.Cleanup(func() { timeNow, timeAfter = oldNow, oldAfter })
+	var waits []time.Duration
+	timeNow = func() time.Time { return testNow }
+	timeAfter = func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		ch := make(chan time.Time, 1)
+		ch <- testNow.Add(d)
+		return ch
+	}
+	return &waits
+}
+
+// errorResponse returns the error go-github returns for a reply to a method
+// request with the status code, headers and JSON body.
+func errorResponse(method string, code int, header map[string]string, body string) error {
+	req, _ := http.NewRequest(method, "https://api.github.com/repos/grpc/grpc-go/pulls", nil)
+	resp := &http.Response{
+		StatusCode: code,
+		Header:     make(http.Header),
+		Request:    req,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+	for k, v := range header {
+		resp.Header.Set(k, v)
+	}
+	return github.CheckResponse(resp)
+}
+
+var (
+	rateLimitErr = errorResponse("GET", http.StatusForbidden, map[string]string{
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     fmt.Sprint(testNow.Add(30 * time.Second).Unix()),
+	}, `{"message": "API rate limit exceeded for user ID 1."}`)
+	abuseErr = errorResponse("GET", http.StatusForbidden, map[string]string{"Retry-After": "10"},
+		`{"message": "You have triggered an abuse detection mechanism.", "documentation_url": "https://developer.github.com/v3/#abuse-rate-limits"}`)
+	abuseNoRetryAfterErr = errorResponse("GET", http.StatusForbidden, nil,
+		`{"message": "You have triggered an abuse detection mechanism.", "documentation_url": "https://developer.github.com/v3/#abuse-rate-limits"}`)
+	secondaryErr   = errorResponse("GET", http.StatusTooManyRequests, map[string]string{"Retry-After": "5"}, `{"message": "Too many requests"}`)
+	forbiddenErr   = errorResponse("GET", http.StatusForbidden, nil, `{"message": "Resource not accessible by integration"}`)
+	getServerErr   = errorResponse("GET", http.StatusBadGateway, nil, `{"message": "Server Error"}`)
+	postServerErr  = errorResponse("POST", http.StatusBadGateway, nil, `{"message": "Server Error"}`)
+	getNotFoundErr = errorResponse("GET", http.StatusNotFound, nil, `{"message": "Not Found"}`)
+	otherErr       = errors.New("connection reset by peer")
+)
+
+func TestRetryAfter(t *testing.T) {
+	stubTime(t)
+	for _, tt := range []struct {
+		name     string
+		err      error
+		wantWait time.Duration
+		wantOK   bool
+	}{
+		{name: "rate limit reset", err: rateLimitErr, wantWait: 31 * time.Second, wantOK: true},
+		{name: "abuse rate limit", err: abuseErr, wantWait: 10 * time.Second, wantOK: true},
+		{name: "abuse rate limit without Retry-After", err: abuseNoRetryAfterErr, wantWait: abuseBackoff, wantOK: true},
+		{name: "secondary rate limit", err: secondaryErr, wantWait: 5 * time.Second, wantOK: true},
+		{name: "forbidden", err: forbiddenErr},
+		{name: "GET server error", err: getServerErr, wantWait: 4 * time.Second, wantOK: true},
+		{name: "POST server error", err: postServerErr},
+		{name: "not found", err: getNotFoundErr},
+		{name: "not a github error", err: otherErr},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, ok := retryAfter(tt.err, 4*time.Second)
+			if wait != tt.wantWait || ok != tt.wantOK {
+				t.Errorf("retryAfter(%v) = %v, %v, want %v, %v", tt.err, wait, ok, tt.wantWait, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		maxRetries int
+		errs       []error
+		wantCalls  int
+		wantWaits  []time.Duration
+		wantErr    error
+	}{
+		{
+			name:      "rate limit",
+			errs:      []error{rateLimitErr, nil},
+			wantCalls: 2,
+			wantWaits: []time.Duration{31 * time.Second},
+		},
+		{
+			name:      "abuse rate limit",
+			errs:      []error{abuseErr, secondaryErr, nil},
+			wantCalls: 3,
+			wantWaits: []time.Duration{10 * time.Second, 5 * time.Second},
+		},
+		{
+			name:      "server errors back off",
+			errs:      []error{getServerErr, getServerErr, getServerErr, nil},
+			wantCalls: 4,
+			wantWaits: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name:       "backoff is capped",
+			maxRetries: 8,
+			errs:       []error{getServerErr, getServerErr, getServerErr, getServerErr, getServerErr, getServerErr, getServerErr, getServerErr, nil},
+			wantCalls:  9,
+			wantWaits:  []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute, time.Minute},
+		},
+		{
+			name:      "too many retries",
+			errs:      []error{getServerErr, getServerErr, getServerErr, getServerErr, getServerErr, getServerErr, nil},
+			wantCalls: 6,
+			wantWaits: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second},
+			wantErr:   getServerErr,
+		},
+		{
+			name:      "POST is not retried",
+			errs:      []error{postServerErr, nil},
+			wantCalls: 1,
+			wantErr:   postServerErr,
+		},
+		{
+			name:      "not found is not retried",
+			errs:      []error{getNotFoundErr, nil},
+			wantCalls: 1,
+			wantErr:   getNotFoundErr,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			waits := stubTime(t)
+			maxRetries := tt.maxRetries
+			if maxRetries == 0 {
+				maxRetries = defaultMaxRetries
+			}
+			c := &Client{maxRetries: maxRetries}
+			calls := 0
+			_, err := c.retry(context.Background(), func() (*github.Response, error) {
+				calls++
+				return nil, tt.errs[calls-1]
+			})
+			if err != tt.wantErr {
+				t.Errorf("retry() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("retry() made %v calls, want %v", calls, tt.wantCalls)
+			}
+			if !reflect.DeepEqual(*waits, tt.wantWaits) {
+				t.Errorf("retry() waited %v, want %v", *waits, tt.wantWaits)
+			}
+		})
+	}
+}
+
+// TestRetryCanceled checks that retry stops waiting when ctx is canceled.
+func TestRetryCanceled(t *testing.T) {
+	stubTime(t)
+	// The wait never ends.
+	timeAfter = func(time.Duration) <-chan time.Time { return nil }
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c := &Client{maxRetries: defaultMaxRetries}
+	calls := 0
+	_, err := c.retry(ctx, func() (*github.Response, error) {
+		calls++
+		return nil, getServerErr
+	})
+	if err == nil || !strings.Contains(err.Error(), "canceled while waiting to retry") {
+		t.Errorf("retry() error = %v, want it canceled while waiting", err)
+	}
+	if calls != 1 {
+		t.Errorf("retry() made %v calls, want 1", calls)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		concurrency int
+		n           int
+	}{
+		{name: "more calls than workers", concurrency: 3, n: 20},
+		{name: "fewer calls than workers", concurrency: 8, n: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{concurrency: tt.concurrency}
+			var (
+				mu        sync.Mutex
+				active    int
+				maxActive int
+				called    = make([]int, tt.n)
+			)
+			err := c.forEach(context.Background(), tt.n, func(ctx context.Context, i int) error {
+				mu.Lock()
+				active++
+				if active > maxActive {
+					maxActive = active
+				}
+				called[i]++
+				mu.Unlock()
+
+				time.Sleep(time.Millisecond)
+
+				mu.Lock()
+				active--
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("forEach() failed: %v", err)
+			}
+			if maxActive > tt.concurrency {
+				t.Errorf("forEach() made %v calls at the same time, want at most %v", maxActive, tt.concurrency)
+			}
+			for i, n := range called {
+				if n != 1 {
+					t.Errorf("forEach() called f(%v) %v times, want 1", i, n)
+				}
+			}
+		})
+	}
+}
+
+// TestForEachError checks that forEach returns the first error, and skips the
+// indexes not started yet.
+func TestForEachError(t *testing.T) {
+	const n = 100
+	c := &Client{concurrency: 2}
+	errFailed := errors.New("failed")
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	err := c.forEach(context.Background(), n, func(ctx context.Context, i int) error {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		if i == 5 {
+			return errFailed
+		}
+		return nil
+	})
+	if err != errFailed {
+		t.Errorf("forEach() error = %v, want %v", err, errFailed)
+	}
+	if calls >= n {
+		t.Errorf("forEach() made all %v calls after an error, want the rest skipped", calls)
+	}
+}
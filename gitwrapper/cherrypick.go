@@ -0,0 +1,192 @@
+package gitwrapper
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// cherryPick applies the change in commit (compared to its first parent) on
+// top of HEAD, and commits it with the original author and message.
+//
+// go-git doesn't support merging, so files are merged here, line by line. A
+// changed file that's the same in HEAD as in the commit's parent is replaced.
+// If it was also changed in HEAD, the changes are merged if they are in
+// different lines, not next to each other, see mergeLines. Otherwise, the
+// worktree is reset and the file is reported as a conflict. Files that already
+// have the change are skipped.
+func (r *Repo) cherryPick(hash, userName, userEmail string) (*CherryPickResult, error) {
+	log.Infof("executing %q", "git cherry-pick "+hash)
+	ret := &CherryPickResult{Commit: hash}
+
+	commit, err := r.r.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find commit %v, was it fetched? %v", hash, err)
+	}
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parent of %v: %v", hash, err)
+	}
+	head, err := r.r.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Head(): %v", err)
+	}
+	headCommit, err := r.r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get head commit: %v", err)
+	}
+
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return nil, err
+	}
+	commitTree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := object.DiffTree(parentTree, commitTree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff %v: %v", hash, err)
+	}
+
+	var changed bool
+	for _, c := range changes {
+		name := c.To.Name
+		if name == "" {
+			name = c.From.Name // Deleted.
+		}
+		from, to, err := c.Files()
+		if err != nil {
+			return nil, err
+		}
+		headFile, err := fileInTree(headTree, name)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case sameFile(headFile, to):
+			log.Infof("%v already has the change in %v", name, hash)
+		case sameFile(headFile, from):
+			if err := r.applyFile(name, to); err != nil {
+				return nil, err
+			}
+			changed = true
+		default:
+			merged, ok, err := mergeFiles(from, headFile, to)
+			if err != nil {
+				return nil, fmt.Errorf("failed to merge %v: %v", name, err)
+			}
+			if !ok {
+				ret.Conflicts = append(ret.Conflicts, name)
+				continue
+			}
+			if c, err := headFile.Contents(); err == nil && c == merged {
+				log.Infof("%v already has the change in %v", name, hash)
+				continue
+			}
+			log.Infof("merged the change in %v from %v", name, hash)
+			if err := r.applyContent(name, merged, to.Mode); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+	}
+
+	if len(ret.Conflicts) > 0 {
+		log.Infof("%v doesn't apply cleanly, conflicts: %v", hash, ret.Conflicts)
+		if err := r.worktree.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.HardReset}); err != nil {
+			return nil, fmt.Errorf("failed to reset after conflicts: %v", err)
+		}
+		return ret, nil
+	}
+	if !changed {
+		ret.Empty = true
+		return ret, nil
+	}
+
+	msg := fmt.Sprintf("%v\n\n(cherry picked from commit %v)", commit.Message, hash)
+	if _, err := r.worktree.Commit(msg, &git.CommitOptions{
+		Author: &commit.Author,
+		Committer: &object.Signature{
+			Name:  userName,
+			Email: userEmail,
+			When:  time.Now(),
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to commit: %v", err)
+	}
+	ret.Applied = true
+	return ret, nil
+}
+
+// fileInTree returns the file at path, or nil if it doesn't exist.
+func fileInTree(tree *object.Tree, path string) (*object.File, error) {
+	f, err := tree.File(path)
+	if err == object.ErrFileNotFound {
+		return nil, nil
+	}
+	return f, err
+}
+
+// sameFile returns whether a and b have the same content. nil means the file
+// doesn't exist.
+func sameFile(a, b *object.File) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Hash == b.Hash
+}
+
+// applyFile writes f to the worktree at name and stages it. If f is nil, the
+// file is removed.
+func (r *Repo) applyFile(name string, f *object.File) error {
+	if f == nil {
+		if _, err := r.worktree.Remove(name); err != nil {
+			return fmt.Errorf("failed to remove %v: %v", name, err)
+		}
+		return nil
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return fmt.Errorf("failed to read %v: %v", name, err)
+	}
+	return r.applyContent(name, content, f.Mode)
+}
+
+// applyContent writes content to the worktree at name with the mode, and
+// stages it.
+func (r *Repo) applyContent(name, content string, mode filemode.FileMode) error {
+	if err := r.fs.MkdirAll(path.Dir(name), 0755); err != nil {
+		return fmt.Errorf("failed to create dir for %v: %v", name, err)
+	}
+	perm := os.FileMode(0644)
+	if mode == filemode.Executable {
+		perm = 0755
+	}
+	file, err := r.fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("failed to open file %q: %v", name, err)
+	}
+	if _, err := file.Write([]byte(content)); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %v: %v", name, err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if _, err := r.worktree.Add(name); err != nil {
+		return fmt.Errorf("failed to add %v: %v", name, err)
+	}
+	return nil
+}
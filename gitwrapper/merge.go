@@ -0,0 +1,126 @@
+package gitwrapper
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/utils/diff"
+)
+
+// hunk is a change of the lines [start, end) of the base to lines.
+type hunk struct {
+	start, end int
+	lines      []string
+}
+
+func (h *hunk) equal(o *hunk) bool {
+	if h.start != o.start || h.end != o.end || len(h.lines) != len(o.lines) {
+		return false
+	}
+	for i := range h.lines {
+		if h.lines[i] != o.lines[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitLines splits s into lines, keeping the "\n"s.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// hunks returns the changes from base to s, in order.
+func hunks(base, s string) []*hunk {
+	var (
+		ret []*hunk
+		cur *hunk
+		pos int
+	)
+	for _, d := range diff.Do(base, s) {
+		lines := splitLines(d.Text)
+		if d.Type == diffmatchpatch.DiffEqual {
+			cur = nil
+			pos += len(lines)
+			continue
+		}
+		if cur == nil {
+			cur = &hunk{start: pos, end: pos}
+			ret = append(ret, cur)
+		}
+		if d.Type == diffmatchpatch.DiffDelete {
+			pos += len(lines)
+			cur.end = pos
+		} else {
+			cur.lines = append(cur.lines, lines...)
+		}
+	}
+	return ret
+}
+
+// mergeLines merges the changes from base to ours and from base to theirs,
+// like a 3-way merge. It returns false if the changes conflict: they change
+// the same lines, or lines next to each other, differently. Binary contents
+// always conflict.
+func mergeLines(base, ours, theirs string) (string, bool) {
+	for _, s := range []string{base, ours, theirs} {
+		if strings.IndexByte(s, 0) >= 0 {
+			return "", false
+		}
+	}
+	all := append(hunks(base, ours), hunks(base, theirs)...)
+	sort.SliceStable(all, func(i, j int) bool { return all[i].start < all[j].start })
+
+	baseLines := splitLines(base)
+	var (
+		b    strings.Builder
+		pos  int
+		prev *hunk
+	)
+	for _, h := range all {
+		if prev != nil && h.start <= prev.end {
+			if h.equal(prev) {
+				// Both sides made the same change.
+				continue
+			}
+			return "", false
+		}
+		for _, l := range baseLines[pos:h.start] {
+			b.WriteString(l)
+		}
+		for _, l := range h.lines {
+			b.WriteString(l)
+		}
+		pos = h.end
+		prev = h
+	}
+	for _, l := range baseLines[pos:] {
+		b.WriteString(l)
+	}
+	return b.String(), true
+}
+
+// mergeFiles merges the changes from base to ours and from base to theirs, see
+// mergeLines. It returns false if a file doesn't exist, i.e. it's added or
+// deleted on one side and changed on the other.
+func mergeFiles(base, ours, theirs *object.File) (string, bool, error) {
+	if base == nil || ours == nil || theirs == nil {
+		return "", false, nil
+	}
+	var contents []string
+	for _, f := range []*object.File{base, ours, theirs} {
+		c, err := f.Contents()
+		if err != nil {
+			return "", false, err
+		}
+		contents = append(contents, c)
+	}
+	merged, ok := mergeLines(contents[0], contents[1], contents[2])
+	return merged, ok, nil
+}
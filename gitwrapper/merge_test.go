@@ -0,0 +1,69 @@
+package gitwrapper
+
+import "testing"
+
+func TestMergeLines(t *testing.T) {
+	const base = "a\nb\nc\nd\ne\n"
+	for _, tt := range []struct {
+		name         string
+		ours, theirs string
+		want         string
+		wantOK       bool
+	}{
+		{
+			name:   "only theirs",
+			ours:   base,
+			theirs: "a\nb\nC\nd\ne\n",
+			want:   "a\nb\nC\nd\ne\n",
+			wantOK: true,
+		},
+		{
+			name:   "different lines",
+			ours:   "A\nb\nc\nd\ne\n",
+			theirs: "a\nb\nc\nd\nE\n",
+			want:   "A\nb\nc\nd\nE\n",
+			wantOK: true,
+		},
+		{
+			name:   "insertions and deletions",
+			ours:   "a\nb\nb2\nc\nd\ne\n",
+			theirs: "a\nb\nc\ne\n",
+			want:   "a\nb\nb2\nc\ne\n",
+			wantOK: true,
+		},
+		{
+			name:   "same change",
+			ours:   "a\nB\nc\nd\ne\n",
+			theirs: "a\nB\nc\nd\ne\n",
+			want:   "a\nB\nc\nd\ne\n",
+			wantOK: true,
+		},
+		{
+			name:   "same line",
+			ours:   "a\nb\nC1\nd\ne\n",
+			theirs: "a\nb\nC2\nd\ne\n",
+		},
+		{
+			name:   "adjacent lines",
+			ours:   "a\nB\nc\nd\ne\n",
+			theirs: "a\nb\nC\nd\ne\n",
+		},
+		{
+			name:   "insertions at the same place",
+			ours:   "a\nb\nb1\nc\nd\ne\n",
+			theirs: "a\nb\nb2\nc\nd\ne\n",
+		},
+		{
+			name:   "binary",
+			ours:   "A\x00\nb\nc\nd\ne\n",
+			theirs: "a\nb\nc\nd\nE\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := mergeLines(base, tt.ours, tt.theirs)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("mergeLines(%q, %q, %q) = %q, %v, want %q, %v", base, tt.ours, tt.theirs, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
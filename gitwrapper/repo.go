@@ -5,19 +5,21 @@ package gitwrapper
 
 import (
 	"fmt"
-	"io"
+	"io/ioutil"
 	"os"
 	"time"
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/cache"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
-	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 
+	"github.com/menghanl/release-git-bot/dryrun"
 	log "github.com/sirupsen/logrus"
 	billy "gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-billy.v4/memfs"
 	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 )
 
@@ -27,24 +29,57 @@ type Repo struct {
 	worktree *git.Worktree
 
 	fs billy.Filesystem
+
+	// baseURL is the URL the repo was cloned from, without the owner and
+	// repo.
+	baseURL string
+	// auth is the auth for fetches, or nil to send no credentials.
+	auth *AuthConfig
+
+	// unlock releases the lock of the on-disk clone, it's nil for clones in
+	// memory.
+	unlock func()
+
+	dryRun *dryrun.Recorder
+}
+
+// Close releases the Repo. For on-disk clones, the directory is unlocked so
+// later runs can reuse it. The Repo can't be used after Close.
+func (r *Repo) Close() {
+	if r.unlock != nil {
+		r.unlock()
+		r.unlock = nil
+	}
 }
 
-// cloneRepo creates a new Repo by cloning from github.
-func cloneRepo(url string) (*Repo, error) {
+// cloneOptions returns the options to clone only branch from url, with at
+// most depth commits if depth is not 0.
+func cloneOptions(url, branch string, depth int, auth transport.AuthMethod) *git.CloneOptions {
+	return &git.CloneOptions{
+		URL:  url,
+		Auth: auth,
+		// Only fetch one branch.
+		ReferenceName: plumbing.NewBranchReferenceName(branch),
+		SingleBranch:  true,
+		Depth:         depth,
+	}
+}
+
+// cloneRepo creates a new Repo by cloning from github into memory.
+func cloneRepo(url, branch string, depth int, authConfig *AuthConfig, dryRun *dryrun.Recorder) (*Repo, error) {
 	log.Infof("executing %q", "git clone "+url)
 
+	auth, err := authConfig.auth()
+	if err != nil {
+		return nil, err
+	}
 	fs := memfs.New()
 	gitdir, err := fs.Chroot(".git")
 	if err != nil {
 		return nil, fmt.Errorf("failed to chroot(.git): %v", err)
 	}
 	s := filesystem.NewStorage(gitdir, cache.NewObjectLRUDefault())
-	r, err := git.Clone(s, fs, &git.CloneOptions{
-		URL: url,
-		// Only fetch master branch.
-		ReferenceName: plumbing.Master,
-		SingleBranch:  true,
-	})
+	r, err := git.Clone(s, fs, cloneOptions(url, branch, depth, auth))
 	if err != nil {
 		return nil, err
 	}
@@ -58,9 +93,92 @@ func cloneRepo(url string) (*Repo, error) {
 		r:        r,
 		worktree: worktree,
 		fs:       fs,
+		dryRun:   dryRun,
 	}, nil
 }
 
+// addRemote adds a remote with url, replacing the remote with the same name
+// if there's one.
+func (r *Repo) addRemote(name, url string) error {
+	log.Infof("executing %q", "git remote add "+name+" "+url)
+	if err := r.r.DeleteRemote(name); err != nil && err != git.ErrRemoteNotFound {
+		return fmt.Errorf("failed to delete remote %v: %v", name, err)
+	}
+	if _, err := r.r.CreateRemote(&config.RemoteConfig{
+		Name: name,
+		URLs: []string{url},
+	}); err != nil {
+		return fmt.Errorf("failed to add remote %v: %v", name, err)
+	}
+	return nil
+}
+
+// fetchRemoteBranch fetches the branch from the remote into its
+// remote-tracking branch, e.g. refs/remotes/upstream/master.
+func (r *Repo) fetchRemoteBranch(remote, branch string) error {
+	log.Infof("executing %q", "git fetch "+remote+" "+branch)
+	refSpec := config.RefSpec(fmt.Sprintf("+refs/heads/%v:refs/remotes/%v/%v", branch, remote, branch))
+	auth, err := r.auth.auth()
+	if err != nil {
+		return err
+	}
+	if err := r.r.Fetch(&git.FetchOptions{
+		RemoteName: remote,
+		RefSpecs:   []config.RefSpec{refSpec},
+		Auth:       auth,
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to fetch %v from %v: %v", branch, remote, err)
+	}
+	return nil
+}
+
+// createBranch creates the branch at the commit of the ref from, e.g. a
+// remote-tracking branch, and checks out to it. An existing branch with the
+// same name is overwritten.
+func (r *Repo) createBranch(name string, from plumbing.ReferenceName) error {
+	fromRef, err := r.r.Reference(from, true)
+	if err != nil {
+		return fmt.Errorf("failed to find %v: %v", from.Short(), err)
+	}
+	log.Infof("executing %q", "branch -f "+name+" "+from.Short())
+	return r.setBranch(name, fromRef.Hash())
+}
+
+// branchAt creates the branch at the commit, and checks out to it. An existing
+// branch with the same name is overwritten.
+func (r *Repo) branchAt(name, commit string) error {
+	h := plumbing.NewHash(commit)
+	if _, err := r.r.CommitObject(h); err != nil {
+		return fmt.Errorf("failed to find commit %v: %v", commit, err)
+	}
+	log.Infof("executing %q", "branch -f "+name+" "+commit)
+	return r.setBranch(name, h)
+}
+
+// setBranch points the branch to the commit, and checks out to it.
+func (r *Repo) setBranch(name string, commit plumbing.Hash) error {
+	newRef := plumbing.NewHashReference(plumbing.NewBranchReferenceName(name), commit)
+	if err := r.r.Storer.SetReference(newRef); err != nil {
+		return fmt.Errorf("failed to add ref to storer: %v", err)
+	}
+	return r.checkoutBranch(name)
+}
+
+// branchFrom checks out to the branch name based on base, the local branch, or
+// the remote-tracking branch if remote is not empty.
+func (r *Repo) branchFrom(name, base, remote string) error {
+	if remote != "" {
+		// git checkout -B release_version_1.14.0 upstream/v1.14.x
+		return r.createBranch(name, plumbing.NewRemoteReferenceName(remote, base))
+	}
+	// git checkout master, all changes should be based on the base branch.
+	if err := r.checkoutBranch(base); err != nil {
+		return err
+	}
+	// git checkout -b release_version_1.14.0
+	return r.checkoutBranch(name)
+}
+
 // checkoutBranch checks out to the given branch.
 //
 // If the branch doesn't exist, a new one will be created.
@@ -106,25 +224,34 @@ func (r *Repo) checkoutBranch(name string) error {
 	return nil
 }
 
-func (r *Repo) updateFile(filepath, commitMsg, userName, userEmail string, write func(io.Writer) error) error {
-	log.Infof("executing %q", "edit "+filepath)
-	fileT, err := r.fs.OpenFile(filepath, os.O_WRONLY|os.O_TRUNC, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open file %q: %v", filepath, err)
-	}
-	err = write(fileT)
-	if err != nil {
-		fileT.Close()
-		return fmt.Errorf("failed to write to file: %v", err)
+// updateFiles edits the files with edit, and commits the changes.
+func (r *Repo) updateFiles(filepaths []string, commitMsg, userName, userEmail string, edit func(filepath string, content []byte) ([]byte, error)) error {
+	for _, filepath := range filepaths {
+		log.Infof("executing %q", "edit "+filepath)
+		content, err := r.readFile(filepath)
+		if err != nil {
+			return err
+		}
+		newContent, err := edit(filepath, content)
+		if err != nil {
+			return err
+		}
+		if err := r.writeFile(filepath, newContent); err != nil {
+			return err
+		}
+		if _, err := r.worktree.Add(filepath); err != nil {
+			return fmt.Errorf("failed to add %q: %v", filepath, err)
+		}
 	}
-	fileT.Close()
 
 	status, err := r.worktree.Status()
 	if err != nil {
 		return fmt.Errorf("failed to get status from worktree: %v", err)
 	}
-	r.worktree.Add(filepath)
 	log.Infof("current worktree status (git status):\n%v", status)
+	if status.IsClean() {
+		return fmt.Errorf("nothing to commit, the files already have the change")
+	}
 
 	log.Infof("executing %q", "git commit -m '"+commitMsg+"'")
 	if _, err := r.worktree.Commit(commitMsg, &git.CommitOptions{
@@ -140,42 +267,100 @@ func (r *Repo) updateFile(filepath, commitMsg, userName, userEmail string, write
 	return nil
 }
 
-func (r *Repo) push(username, password string) error {
+func (r *Repo) readFile(filepath string) ([]byte, error) {
+	f, err := r.fs.Open(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %v", filepath, err)
+	}
+	defer f.Close()
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %q: %v", filepath, err)
+	}
+	return content, nil
+}
+
+func (r *Repo) writeFile(filepath string, content []byte) error {
+	f, err := r.fs.OpenFile(filepath, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open file %q: %v", filepath, err)
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write to file: %v", err)
+	}
+	return f.Close()
+}
+
+// push pushes the HEAD branch to origin. Other local branches, like the ones
+// fetched from upstream, are not pushed.
+//
+// The branch is force pushed, it's the bot's own branch, and a rerun of a
+// failed step makes a new commit on it.
+func (r *Repo) push(auth transport.AuthMethod) error {
+	if r.dryRun != nil {
+		return r.recordPush()
+	}
+	head, err := r.r.Head()
+	if err != nil {
+		return fmt.Errorf("failed to call Head(): %v", err)
+	}
 	if err := r.r.Push(&git.PushOptions{
-		Auth: &http.BasicAuth{
-			Username: username,
-			Password: password,
-		},
+		RefSpecs: []config.RefSpec{config.RefSpec("+" + head.Name() + ":" + head.Name())},
+		Auth:     auth,
 		Progress: os.Stdout,
-	}); err != nil {
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
 		return fmt.Errorf("failed to push: %v", err)
 	}
 	return nil
 }
 
+// recordPush records the push of the HEAD branch, with the diff in the HEAD
+// commit, instead of pushing.
+func (r *Repo) recordPush() error {
+	headRef, err := r.r.Head()
+	if err != nil {
+		return fmt.Errorf("failed to call Head(): %v", err)
+	}
+	patch, err := r.diffInHeadCommit()
+	if err != nil {
+		return err
+	}
+	r.dryRun.Record("push", fmt.Sprintf("push branch %v to origin", headRef.Name().Short()), patch)
+	return nil
+}
+
 func (r *Repo) printDiffInHeadCommit() error {
 	log.Infof("executing %q", "git diff HEAD~")
+	patch, err := r.diffInHeadCommit()
+	if err != nil {
+		return err
+	}
+	log.Info(patch)
+	return nil
+}
+
+// diffInHeadCommit returns the diff between HEAD and its parent.
+func (r *Repo) diffInHeadCommit() (string, error) {
 	headRef, err := r.r.Head()
 	if err != nil {
-		return fmt.Errorf("failed to call Head(): %v", err)
+		return "", fmt.Errorf("failed to call Head(): %v", err)
 	}
 	headCommit, err := r.r.CommitObject(headRef.Hash())
 	if err != nil {
-		return fmt.Errorf("failed to get head commit: %v", err)
+		return "", fmt.Errorf("failed to get head commit: %v", err)
 	}
 	parentCommit, err := headCommit.Parent(0)
 	if err != nil {
-		return fmt.Errorf("failed to get parent of head: %v", err)
+		return "", fmt.Errorf("failed to get parent of head: %v", err)
 	}
 
 	// patch, err := parentTree.Patch(headTree)
 	patch, err := parentCommit.Patch(headCommit)
 	if err != nil {
-		return fmt.Errorf("failed to get patch: %v", err)
+		return "", fmt.Errorf("failed to get patch: %v", err)
 	}
-	log.Info(patch)
-
-	return nil
+	return patch.String(), nil
 }
 
 // For debugging only.
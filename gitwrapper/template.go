@@ -1,31 +0,0 @@
-package gitwrapper
-
-import "github.com/alecthomas/template"
-
-// TODO: read template file instead.
-// https://godoc.org/text/template#ParseFiles
-const versionTemplateStr = `/*
- *
- * Copyright 2018 gRPC authors.
- *
- * Licensed under the Apache License, Version 2.0 (the "License");
- * you may not use this file except in compliance with the License.
- * You may obtain a copy of the License at
- *
- *     http://www.apache.org/licenses/LICENSE-2.0
- *
- * Unless required by applicable law or agreed to in writing, software
- * distributed under the License is distributed on an "AS IS" BASIS,
- * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
- * See the License for the specific language governing permissions and
- * limitations under the License.
- *
- */
-
-package grpc
-
-// Version is the current grpc version.
-const Version = "{{.version}}"
-`
-
-var versionTemplate = template.Must(template.New("version").Parse(versionTemplateStr))
@@ -0,0 +1,118 @@
+package gitwrapper
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strconv"
+)
+
+// VersionFile describes where the version is in a file. Exactly one of
+// GoConst and Pattern should be set.
+type VersionFile struct {
+	// Path is the filepath of the file.
+	Path string
+	// GoConst is the name of a Go string const that holds the version, e.g.
+	// "Version" in grpc-go's version.go.
+	GoConst string
+	// Pattern is a regexp with one capturing group that matches the version,
+	// e.g. `version = '(.*)'` for a gradle file.
+	Pattern string
+}
+
+func (f *VersionFile) String() string {
+	if f.GoConst != "" {
+		return fmt.Sprintf("%v (const %v)", f.Path, f.GoConst)
+	}
+	return fmt.Sprintf("%v (pattern %q)", f.Path, f.Pattern)
+}
+
+// replaceVersion returns content with the version literal described by f
+// replaced by newVersion. Everything else in content is kept as is.
+//
+// It fails if the version is not found exactly once.
+func replaceVersion(content []byte, f *VersionFile, newVersion string) ([]byte, error) {
+	switch {
+	case f.GoConst != "" && f.Pattern != "":
+		return nil, fmt.Errorf("%v: only one of GoConst and Pattern can be set", f.Path)
+	case f.GoConst != "":
+		return replaceGoConst(content, f.Path, f.GoConst, newVersion)
+	case f.Pattern != "":
+		return replacePattern(content, f.Path, f.Pattern, newVersion)
+	}
+	return nil, fmt.Errorf("%v: one of GoConst and Pattern must be set", f.Path)
+}
+
+// replaceGoConst replaces the value of the string const named name.
+func replaceGoConst(content []byte, path, name, newVersion string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, content, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %v", path, err)
+	}
+
+	var lits []*ast.BasicLit
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, n := range vs.Names {
+				if n.Name != name {
+					continue
+				}
+				if i >= len(vs.Values) {
+					return nil, fmt.Errorf("%v: const %v has no value", path, name)
+				}
+				lit, ok := vs.Values[i].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return nil, fmt.Errorf("%v: const %v is not a string literal", path, name)
+				}
+				lits = append(lits, lit)
+			}
+		}
+	}
+	if len(lits) != 1 {
+		return nil, fmt.Errorf("%v: expected exactly one const %v, found %v", path, name, len(lits))
+	}
+
+	lit := lits[0]
+	start := fset.Position(lit.Pos()).Offset
+	end := fset.Position(lit.End()).Offset
+	newLit := strconv.Quote(newVersion)
+	if lit.Value[0] == '`' {
+		newLit = "`" + newVersion + "`"
+	}
+	return splice(content, start, end, newLit), nil
+}
+
+// replacePattern replaces the first capturing group of pattern.
+func replacePattern(content []byte, path, pattern, newVersion string) ([]byte, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%v: invalid pattern %q: %v", path, pattern, err)
+	}
+	if re.NumSubexp() != 1 {
+		return nil, fmt.Errorf("%v: pattern %q must have exactly one capturing group, has %v", path, pattern, re.NumSubexp())
+	}
+	matches := re.FindAllSubmatchIndex(content, -1)
+	if len(matches) != 1 {
+		return nil, fmt.Errorf("%v: expected pattern %q to match exactly once, matched %v times", path, pattern, len(matches))
+	}
+	m := matches[0]
+	return splice(content, m[2], m[3], newVersion), nil
+}
+
+// splice returns content with content[start:end] replaced by s.
+func splice(content []byte, start, end int, s string) []byte {
+	var b bytes.Buffer
+	b.Write(content[:start])
+	b.WriteString(s)
+	b.Write(content[end:])
+	return b.Bytes()
+}
@@ -0,0 +1,106 @@
+package gitwrapper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplaceVersion(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		content string
+		f       *VersionFile
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "go const",
+			content: "package grpc\n\n// Version is the current grpc version.\nconst Version = \"1.14.0-dev\"\n",
+			f:       &VersionFile{Path: "version.go", GoConst: "Version"},
+			want:    "package grpc\n\n// Version is the current grpc version.\nconst Version = \"1.14.0\"\n",
+		},
+		{
+			name:    "go const in a group",
+			content: "package grpc\n\nconst (\n\tName    = \"grpc\"\n\tVersion = `1.14.0-dev`\n)\n",
+			f:       &VersionFile{Path: "version.go", GoConst: "Version"},
+			want:    "package grpc\n\nconst (\n\tName    = \"grpc\"\n\tVersion = `1.14.0`\n)\n",
+		},
+		{
+			name:    "go const missing",
+			content: "package grpc\n\nconst Name = \"grpc\"\n",
+			f:       &VersionFile{Path: "version.go", GoConst: "Version"},
+			wantErr: "version.go: expected exactly one const Version, found 0",
+		},
+		{
+			name:    "go const twice",
+			content: "package grpc\n\nconst Version = \"1.14.0-dev\"\n\nfunc f() {}\n\nconst Version = \"1.13.0\"\n",
+			f:       &VersionFile{Path: "version.go", GoConst: "Version"},
+			wantErr: "version.go: expected exactly one const Version, found 2",
+		},
+		{
+			name:    "go const not a string",
+			content: "package grpc\n\nconst Version = 14\n",
+			f:       &VersionFile{Path: "version.go", GoConst: "Version"},
+			wantErr: "version.go: const Version is not a string literal",
+		},
+		{
+			name:    "go const not go",
+			content: "version = '1.14.0-dev'\n",
+			f:       &VersionFile{Path: "version.go", GoConst: "Version"},
+			wantErr: "failed to parse version.go",
+		},
+		{
+			name:    "pattern",
+			content: "group = 'io.grpc'\nversion = '1.14.0-SNAPSHOT'\n",
+			f:       &VersionFile{Path: "build.gradle", Pattern: `version = '(.*)'`},
+			want:    "group = 'io.grpc'\nversion = '1.14.0'\n",
+		},
+		{
+			name:    "pattern missing",
+			content: "group = 'io.grpc'\n",
+			f:       &VersionFile{Path: "build.gradle", Pattern: `version = '(.*)'`},
+			wantErr: "build.gradle: expected pattern \"version = '(.*)'\" to match exactly once, matched 0 times",
+		},
+		{
+			name:    "pattern twice",
+			content: "version = '1.14.0-SNAPSHOT'\nversion = '1.14.0-SNAPSHOT'\n",
+			f:       &VersionFile{Path: "build.gradle", Pattern: `version = '(.*)'`},
+			wantErr: "build.gradle: expected pattern \"version = '(.*)'\" to match exactly once, matched 2 times",
+		},
+		{
+			name:    "pattern without a group",
+			content: "version = '1.14.0-SNAPSHOT'\n",
+			f:       &VersionFile{Path: "build.gradle", Pattern: `version = '.*'`},
+			wantErr: "must have exactly one capturing group, has 0",
+		},
+		{
+			name:    "invalid pattern",
+			content: "version = '1.14.0-SNAPSHOT'\n",
+			f:       &VersionFile{Path: "build.gradle", Pattern: `version = '(.*'`},
+			wantErr: "build.gradle: invalid pattern",
+		},
+		{
+			name:    "both",
+			f:       &VersionFile{Path: "version.go", GoConst: "Version", Pattern: `"(.*)"`},
+			wantErr: "version.go: only one of GoConst and Pattern can be set",
+		},
+		{
+			name:    "neither",
+			f:       &VersionFile{Path: "version.go"},
+			wantErr: "version.go: one of GoConst and Pattern must be set",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := replaceVersion([]byte(tt.content), tt.f, "1.14.0")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("replaceVersion() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || string(got) != tt.want {
+				t.Errorf("replaceVersion() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
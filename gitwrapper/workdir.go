@@ -0,0 +1,175 @@
+package gitwrapper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/menghanl/release-git-bot/dryrun"
+	log "github.com/sirupsen/logrus"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// openRepo creates a new Repo in dir, reusing the clone of url from earlier
+// runs if there's one. Only branch is fetched, and the repo is reset to look
+// like a fresh clone of it.
+//
+// dir is locked until the Repo is closed, so concurrent runs don't use the same
+// clone.
+func openRepo(dir, url, branch string, depth int, authConfig *AuthConfig, dryRun *dryrun.Recorder) (*Repo, error) {
+	auth, err := authConfig.auth()
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	r, err := openOrClone(dir, url, branch, depth, auth)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	worktree, err := r.Worktree()
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("failed to get worktree: %v", err)
+	}
+	return &Repo{
+		r:        r,
+		worktree: worktree,
+		fs:       worktree.Filesystem,
+		unlock:   unlock,
+		dryRun:   dryRun,
+	}, nil
+}
+
+// openOrClone opens the repo in dir and updates branch from origin. If dir
+// doesn't exist or is empty, url is cloned into it instead.
+func openOrClone(dir, url, branch string, depth int, auth transport.AuthMethod) (*git.Repository, error) {
+	r, err := git.PlainOpen(dir)
+	if err == git.ErrRepositoryNotExists {
+		if files, err := ioutil.ReadDir(dir); err == nil && len(files) > 0 {
+			return nil, fmt.Errorf("%v is not empty and not a git repo", dir)
+		}
+		log.Infof("executing %q", "git clone "+url+" "+dir)
+		r, err := git.PlainClone(dir, false, cloneOptions(url, branch, depth, auth))
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repo in %v: %v", dir, err)
+	}
+
+	remote, err := r.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the origin of the repo in %v: %v", dir, err)
+	}
+	if urls := remote.Config().URLs; len(urls) != 1 || urls[0] != url {
+		return nil, fmt.Errorf("%v is a clone of %v, not %v, use a different directory", dir, strings.Join(urls, ","), url)
+	}
+	if err := resetToOrigin(r, branch, depth, auth); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// resetToOrigin fetches branch from origin, and makes the repo the same as a
+// fresh clone: branch is checked out at the fetched commit, the worktree is
+// clean, and the other local branches, left by earlier runs, are deleted.
+func resetToOrigin(r *git.Repository, branch string, depth int, auth transport.AuthMethod) error {
+	log.Infof("executing %q", "git fetch origin "+branch)
+	refSpec := config.RefSpec(fmt.Sprintf("+refs/heads/%v:refs/remotes/%v/%v", branch, git.DefaultRemoteName, branch))
+	if err := r.Fetch(&git.FetchOptions{
+		RefSpecs: []config.RefSpec{refSpec},
+		Depth:    depth,
+		Tags:     git.NoTags,
+		Auth:     auth,
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to fetch %v: %v", branch, err)
+	}
+	remoteRef, err := r.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch), true)
+	if err != nil {
+		return fmt.Errorf("failed to find the fetched branch %v: %v", branch, err)
+	}
+
+	log.Infof("executing %q", "git checkout -f -B "+branch+" origin/"+branch)
+	branchRef := plumbing.NewBranchReferenceName(branch)
+	if err := r.Storer.SetReference(plumbing.NewHashReference(branchRef, remoteRef.Hash())); err != nil {
+		return fmt.Errorf("failed to reset %v: %v", branch, err)
+	}
+	worktree, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %v", err)
+	}
+	if err := worktree.Checkout(&git.CheckoutOptions{
+		Branch: branchRef,
+		Force:  true,
+	}); err != nil {
+		return fmt.Errorf("failed to checkout %v: %v", branch, err)
+	}
+	if err := worktree.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("failed to clean worktree: %v", err)
+	}
+
+	// Branches are created only if they don't exist, see checkoutBranch, so
+	// the ones from earlier runs would be reused with their old commits.
+	branches, err := r.Branches()
+	if err != nil {
+		return fmt.Errorf("failed to list branches: %v", err)
+	}
+	var stale []plumbing.ReferenceName
+	branches.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name() != branchRef {
+			stale = append(stale, ref.Name())
+		}
+		return nil
+	})
+	for _, name := range stale {
+		log.Infof("executing %q", "git branch -D "+name.Short())
+		if err := r.Storer.RemoveReference(name); err != nil {
+			return fmt.Errorf("failed to delete branch %v: %v", name.Short(), err)
+		}
+	}
+	return nil
+}
+
+// lockDir creates the lock file of dir, dir+".lock", with the pid of this
+// process. It fails if the lock file already exists. The returned function
+// deletes the lock file.
+func lockDir(dir string) (func(), error) {
+	dir = filepath.Clean(dir)
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the parent of %v: %v", dir, err)
+	}
+	lock := dir + ".lock"
+	f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		pid, _ := ioutil.ReadFile(lock)
+		return nil, fmt.Errorf("%v is in use by another run (pid %v), delete %v if that run is gone", dir, strings.TrimSpace(string(pid)), lock)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %v: %v", dir, err)
+	}
+	_, err = f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(lock)
+		return nil, fmt.Errorf("failed to write lock file %v: %v", lock, err)
+	}
+	return func() {
+		if err := os.Remove(lock); err != nil {
+			log.Warningf("failed to delete lock file %v: %v", lock, err)
+		}
+	}, nil
+}
@@ -2,7 +2,12 @@ package gitwrapper
 
 import (
 	"fmt"
-	"io"
+	"strings"
+
+	"github.com/menghanl/release-git-bot/dryrun"
+	"golang.org/x/oauth2"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
 )
 
 // AuthConfig configures auth.
@@ -11,6 +16,35 @@ type AuthConfig struct {
 	Username string
 	// Password is the auth password.
 	Password string
+	// TokenSource, if not nil, is used instead of Password. A token is got
+	// for every clone, fetch and push, so tokens that expire, like github app
+	// installation tokens, are refreshed.
+	TokenSource oauth2.TokenSource
+}
+
+// password returns the password, or a token from the TokenSource.
+func (c *AuthConfig) password() (string, error) {
+	if c.TokenSource == nil {
+		return c.Password, nil
+	}
+	t, err := c.TokenSource.Token()
+	if err != nil {
+		return "", fmt.Errorf("failed to get token: %v", err)
+	}
+	return t.AccessToken, nil
+}
+
+// auth returns the credentials for a git request, or nil if c is nil, to send
+// none.
+func (c *AuthConfig) auth() (transport.AuthMethod, error) {
+	if c == nil {
+		return nil, nil
+	}
+	password, err := c.password()
+	if err != nil {
+		return nil, err
+	}
+	return &http.BasicAuth{Username: c.Username, Password: password}, nil
 }
 
 // GithubCloneConfig config github clone.
@@ -19,23 +53,105 @@ type GithubCloneConfig struct {
 	Owner string
 	// Repo is the repo name.
 	Repo string
+	// Branch is the branch to clone. If empty, "master" will be cloned.
+	Branch string
+	// BaseURL is the URL repos are cloned from, the repo is at
+	// BaseURL/Owner/Repo. If empty, "https://github.com" will be used. Later
+	// fetches from the Repo use the same BaseURL.
+	BaseURL string
+
+	// Dir, if not empty, is the directory the repo is cloned into, instead of
+	// memory. The clone is reused by later runs with the same Dir, only
+	// Branch is fetched and the repo is reset to it. Dir is locked until the
+	// Repo is closed.
+	Dir string
+	// Depth, if not 0, limits the clone to the last Depth commits of Branch.
+	Depth int
+	// Auth, if not nil, is the auth to clone, and for the later fetches from
+	// the Repo. Pushes use the auth in PublicConfig.
+	Auth *AuthConfig
+
+	// DryRun, if not nil, records the pushes with their diffs instead of
+	// pushing. Local changes are still made.
+	DryRun *dryrun.Recorder
 }
 
-// GithubClone creates a new Repo by cloning from github.
+// GithubClone creates a new Repo by cloning from github. The Repo should be
+// closed when done.
 func GithubClone(c *GithubCloneConfig) (*Repo, error) {
-	url := fmt.Sprintf("https://github.com/%v/%v", c.Owner, c.Repo)
-	return cloneRepo(url)
+	baseURL := strings.TrimSuffix(c.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = "https://github.com"
+	}
+	url := fmt.Sprintf("%v/%v/%v", baseURL, c.Owner, c.Repo)
+	branch := c.Branch
+	if branch == "" {
+		branch = "master"
+	}
+	var (
+		r   *Repo
+		err error
+	)
+	if c.Dir != "" {
+		r, err = openRepo(c.Dir, url, branch, c.Depth, c.Auth, c.DryRun)
+	} else {
+		r, err = cloneRepo(url, branch, c.Depth, c.Auth, c.DryRun)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.baseURL = baseURL
+	r.auth = c.Auth
+	return r, nil
+}
+
+// RemoteConfig configs a remote on github, or on the BaseURL the Repo was
+// cloned from.
+type RemoteConfig struct {
+	// Name is the name of the remote, e.g. "upstream".
+	Name string
+	// Owner is the owner's username on github.
+	Owner string
+	// Repo is the repo name.
+	Repo string
+}
+
+// AddRemote adds a remote, so its branches can be fetched with
+// FetchRemoteBranch. A remote with the same name is replaced.
+func (r *Repo) AddRemote(c *RemoteConfig) error {
+	return r.addRemote(c.Name, fmt.Sprintf("%v/%v/%v", r.baseURL, c.Owner, c.Repo))
+}
+
+// FetchRemoteBranch fetches a branch from the remote, so changes can be based
+// on it, see VersionChangeConfig.BaseRemote.
+//
+// For example, fetch the upstream release branch before making a version
+// change on it, instead of using the fork's branch, which may be behind.
+func (r *Repo) FetchRemoteBranch(remote, branch string) error {
+	return r.fetchRemoteBranch(remote, branch)
 }
 
 // VersionChangeConfig contains the settings to make a version change.
 type VersionChangeConfig struct {
-	// VersionFile is the filepath of the version file.
-	VersionFile string
+	// VersionFiles are the files with the version to be changed. The version
+	// in each file must be found exactly once.
+	VersionFiles []*VersionFile
 	// NewVersion is the new version to be changed to. It's a string so it could
 	// contain "-dev".
 	NewVersion string
 	// BranchName is the branch where the change will be made.
 	BranchName string
+	// BaseBranch is the branch the change will be based on. If empty,
+	// "master" will be used.
+	BaseBranch string
+	// BaseRemote, if not empty, is the remote of BaseBranch, e.g. "upstream".
+	// The branch must have been fetched with FetchRemoteBranch. If empty, the
+	// local BaseBranch is used.
+	BaseRemote string
+	// BaseCommit, if not empty, is the hash of the commit the change is based
+	// on, instead of BaseBranch, e.g. for a branch that's only recorded in dry
+	// run. The commit must have been fetched, e.g. with the branch it's on.
+	BaseCommit string
 	// SkipCI controls whether travis tests will be skipped.
 	SkipCI bool
 
@@ -50,13 +166,22 @@ type VersionChangeConfig struct {
 
 // MakeVersionChange makes the version change in repo.
 func (r *Repo) MakeVersionChange(c *VersionChangeConfig) error {
-	// git checkout master, all changes should be based on master.
-	if err := r.checkoutBranch("master"); err != nil {
-		return err
+	if len(c.VersionFiles) == 0 {
+		return fmt.Errorf("config.VersionFiles is empty")
 	}
-	// git checkout -b release_version_1.14.0
-	if err := r.checkoutBranch(c.BranchName); err != nil {
-		return err
+
+	if c.BaseCommit != "" {
+		if err := r.branchAt(c.BranchName, c.BaseCommit); err != nil {
+			return err
+		}
+	} else {
+		baseBranch := c.BaseBranch
+		if baseBranch == "" {
+			baseBranch = "master"
+		}
+		if err := r.branchFrom(c.BranchName, baseBranch, c.BaseRemote); err != nil {
+			return err
+		}
 	}
 
 	if c.NewVersion == "" {
@@ -68,13 +193,31 @@ func (r *Repo) MakeVersionChange(c *VersionChangeConfig) error {
 	if c.SkipCI {
 		commitMsg += "\n\n[skip ci] Skipping Travis. Version number change only"
 	}
-	if err := r.updateFile(
-		c.VersionFile,
+	// A file can be listed more than once, to change the version in
+	// different places.
+	var (
+		filepaths []string
+		files     = make(map[string][]*VersionFile)
+	)
+	for _, f := range c.VersionFiles {
+		if _, ok := files[f.Path]; !ok {
+			filepaths = append(filepaths, f.Path)
+		}
+		files[f.Path] = append(files[f.Path], f)
+	}
+	if err := r.updateFiles(
+		filepaths,
 		commitMsg,
 		c.UserName,
 		c.UserEmail,
-		func(w io.Writer) error {
-			return versionTemplate.Execute(w, map[string]string{"version": c.NewVersion})
+		func(filepath string, content []byte) ([]byte, error) {
+			for _, f := range files[filepath] {
+				var err error
+				if content, err = replaceVersion(content, f, c.NewVersion); err != nil {
+					return nil, err
+				}
+			}
+			return content, nil
 		},
 	); err != nil {
 		return err
@@ -87,6 +230,62 @@ func (r *Repo) MakeVersionChange(c *VersionChangeConfig) error {
 	return nil
 }
 
+// CherryPickConfig contains the settings to cherry-pick commits.
+type CherryPickConfig struct {
+	// Commits are the hashes of the commits to cherry-pick, in order. They
+	// must have been fetched, see FetchRemoteBranch.
+	Commits []string
+	// BaseBranch is the branch the commits will be applied on, e.g. the
+	// release branch.
+	BaseBranch string
+	// BaseRemote, if not empty, is the remote of BaseBranch, see
+	// VersionChangeConfig.BaseRemote.
+	BaseRemote string
+	// BranchName is the branch where the commits will be made. It's created
+	// from BaseBranch.
+	BranchName string
+
+	// The user name for the committer. The authors of the original commits
+	// are kept.
+	UserName string
+	// The email address for the committer.
+	UserEmail string
+}
+
+// CherryPickResult is the result of cherry-picking one commit.
+type CherryPickResult struct {
+	// Commit is the hash of the cherry-picked commit.
+	Commit string
+	// Applied is true if the commit was applied cleanly and committed.
+	Applied bool
+	// Empty is true if the base already has all the changes in the commit.
+	Empty bool
+	// Conflicts contains the files that couldn't be merged: changed in the
+	// same or adjacent lines on both sides, or added or deleted on one side
+	// and changed on the other. The commit is not applied if it's not empty.
+	Conflicts []string
+}
+
+// CherryPick applies the commits one by one on a new branch based on
+// c.BaseBranch. Commits that don't apply cleanly are skipped, and reported in
+// the results.
+func (r *Repo) CherryPick(c *CherryPickConfig) ([]*CherryPickResult, error) {
+	if err := r.branchFrom(c.BranchName, c.BaseBranch, c.BaseRemote); err != nil {
+		return nil, err
+	}
+
+	var ret []*CherryPickResult
+	for _, cmt := range c.Commits {
+		// git cherry-pick <commit>
+		res, err := r.cherryPick(cmt, c.UserName, c.UserEmail)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, res)
+	}
+	return ret, nil
+}
+
 // PublicConfig configures public.
 type PublicConfig struct {
 	// The remote to be pushed to.
@@ -101,7 +300,11 @@ func (r *Repo) Publish(c *PublicConfig) error {
 	// request instead.
 
 	// git push -u
-	if err := r.push(c.Auth.Username, c.Auth.Password); err != nil {
+	auth, err := c.Auth.auth()
+	if err != nil {
+		return err
+	}
+	if err := r.push(auth); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,78 @@
+package gitwrapper
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/menghanl/release-git-bot/internal/fakegithub"
+)
+
+func TestGithubCloneAuth(t *testing.T) {
+	fake, err := fakegithub.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+	if err := fake.CreateRepo("grpc", "grpc-go", map[string]string{"version.go": "package grpc\n"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.Fork("grpc", "grpc-go", "gopher"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.Commit("grpc", "grpc-go", "v1.14.x", "Fix a crash", map[string]string{"fix.go": "package grpc\n"}); err != nil {
+		t.Fatal(err)
+	}
+	auth := &AuthConfig{Username: "gopher", Password: "fake-token"}
+
+	for _, tt := range []struct {
+		name string
+		dir  bool
+	}{
+		{name: "memory"},
+		{name: "dir", dir: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &GithubCloneConfig{Owner: "gopher", Repo: "grpc-go", BaseURL: fake.GitURL}
+			if tt.dir {
+				c.Dir = filepath.Join(t.TempDir(), "grpc-go")
+			}
+			if r, err := GithubClone(c); err == nil || !strings.Contains(err.Error(), "authentication required") {
+				if r != nil {
+					r.Close()
+				}
+				t.Fatalf("GithubClone() without auth: want an authentication error, got %v", err)
+			}
+
+			c.Auth = auth
+			r, err := GithubClone(c)
+			if err != nil {
+				t.Fatalf("GithubClone() with auth: %v", err)
+			}
+			if err := r.AddRemote(&RemoteConfig{Name: "upstream", Owner: "grpc", Repo: "grpc-go"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.FetchRemoteBranch("upstream", "v1.14.x"); err != nil {
+				t.Errorf("FetchRemoteBranch() with the clone's auth: %v", err)
+			}
+			r.Close()
+
+			if !tt.dir {
+				return
+			}
+			// Reopening the clone fetches the branch from origin.
+			r, err = GithubClone(c)
+			if err != nil {
+				t.Fatalf("GithubClone() of the existing clone with auth: %v", err)
+			}
+			r.Close()
+			c.Auth = nil
+			if r, err := GithubClone(c); err == nil || !strings.Contains(err.Error(), "authentication required") {
+				if r != nil {
+					r.Close()
+				}
+				t.Errorf("GithubClone() of the existing clone without auth: want an authentication error, got %v", err)
+			}
+		})
+	}
+}
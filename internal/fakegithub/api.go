@@ -0,0 +1,813 @@
+package fakegithub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// httpError is an error with the status code to reply with.
+type httpError struct {
+	code int
+	msg  string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+func notFound(format string, a ...interface{}) error {
+	return &httpError{code: http.StatusNotFound, msg: fmt.Sprintf(format, a...)}
+}
+
+func badRequest(format string, a ...interface{}) error {
+	return &httpError{code: http.StatusUnprocessableEntity, msg: fmt.Sprintf(format, a...)}
+}
+
+// route is one API endpoint. The pattern is matched against the path
+// segments, where "*" matches any one segment, and a trailing "**" matches
+// the rest of the path.
+type route struct {
+	method  string
+	pattern string
+	handle  func(s *Server, req *request) (interface{}, error)
+}
+
+// request is an API request, with the path segments matched by the route.
+type request struct {
+	r    *http.Request
+	w    http.ResponseWriter
+	args []string
+}
+
+// repo returns the repo from the first two args.
+func (req *request) repo(s *Server) (*repo, error) {
+	r := s.getRepo(req.args[0], req.args[1])
+	if r == nil {
+		return nil, notFound("repo %v/%v doesn't exist", req.args[0], req.args[1])
+	}
+	return r, nil
+}
+
+var routes = []route{
+	{"GET", "user", (*Server).getUser},
+	{"GET", "user/emails", (*Server).getEmails},
+	{"GET", "users/*", (*Server).getUserByLogin},
+	{"GET", "app", (*Server).getApp},
+	{"POST", "app/installations/*/access_tokens", (*Server).createInstallationToken},
+	{"GET", "orgs/*/members", (*Server).listOrgMembers},
+	{"GET", "repos/*/*/milestones", (*Server).listMilestones},
+	{"GET", "repos/*/*/issues", (*Server).listIssues},
+	{"GET", "repos/*/*/issues/*", (*Server).getIssue},
+	{"GET", "repos/*/*/issues/*/events", (*Server).listIssueEvents},
+	{"GET", "repos/*/*/git/refs/heads/**", (*Server).getRef},
+	{"PATCH", "repos/*/*/git/refs/heads/**", (*Server).updateRef},
+	{"POST", "repos/*/*/git/refs", (*Server).createRef},
+	{"GET", "repos/*/*/pulls", (*Server).listPRs},
+	{"POST", "repos/*/*/pulls", (*Server).createPR},
+	{"GET", "repos/*/*/pulls/*", (*Server).getPR},
+	{"GET", "repos/*/*/commits/*/status", (*Server).getCombinedStatus},
+	{"GET", "repos/*/*/commits/*/check-runs", (*Server).listCheckRuns},
+	{"GET", "repos/*/*/commits", (*Server).listCommits},
+	{"GET", "repos/*/*/commits/*/pulls", (*Server).listPRsForCommit},
+	{"GET", "repos/*/*/commits/*", (*Server).getCommit},
+	{"GET", "repos/*/*/releases", (*Server).listReleases},
+	{"POST", "repos/*/*/releases", (*Server).createRelease},
+	{"PATCH", "repos/*/*/releases/*", (*Server).editRelease},
+	{"GET", "repos/*/*/tags", (*Server).listTags},
+	{"GET", "repos/*/*/compare/*", (*Server).compare},
+	{"GET", "search/issues", (*Server).searchIssues},
+}
+
+// match returns the path segments matched by the wildcards in pattern, or
+// false if path doesn't match.
+func match(pattern string, path []string) ([]string, bool) {
+	var args []string
+	pp := strings.Split(pattern, "/")
+	for i, p := range pp {
+		if p == "**" {
+			if i >= len(path) {
+				return nil, false
+			}
+			return append(args, strings.Join(path[i:], "/")), true
+		}
+		if i >= len(path) {
+			return nil, false
+		}
+		switch p {
+		case "*":
+			args = append(args, path[i])
+		case path[i]:
+		default:
+			return nil, false
+		}
+	}
+	return args, len(pp) == len(path)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" && s.replyInjectedError(w) {
+		return
+	}
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	// Like github, JWTs are only accepted by the app endpoints.
+	if path[0] != "app" && isJWT(r.Header.Get("Authorization")) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "fakegithub: a JWT can only be used for the app endpoints"})
+		return
+	}
+	for _, rt := range routes {
+		if rt.method != r.Method {
+			continue
+		}
+		args, ok := match(rt.pattern, path)
+		if !ok {
+			continue
+		}
+		s.mu.Lock()
+		ret, err := rt.handle(s, &request{r: r, w: w, args: args})
+		s.mu.Unlock()
+		if err != nil {
+			code := http.StatusInternalServerError
+			if he, ok := err.(*httpError); ok {
+				code = he.code
+			}
+			writeJSON(w, code, map[string]string{"message": err.Error()})
+			return
+		}
+		code := http.StatusOK
+		if r.Method == "POST" {
+			code = http.StatusCreated
+		}
+		writeJSON(w, code, ret)
+		return
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"message": fmt.Sprintf("fakegithub: %v %v is not implemented", r.Method, r.URL.Path)})
+}
+
+// replyInjectedError replies with the next error from InjectErrors, and
+// returns false if there's none.
+func (s *Server) replyInjectedError(w http.ResponseWriter) bool {
+	s.mu.Lock()
+	if len(s.injected) == 0 {
+		s.mu.Unlock()
+		return false
+	}
+	e := s.injected[0]
+	s.injected = s.injected[1:]
+	s.mu.Unlock()
+
+	if e.code == http.StatusForbidden {
+		w.Header().Set("Retry-After", strconv.Itoa(e.retryAfter))
+		writeJSON(w, e.code, map[string]string{
+			"message":           "You have triggered an abuse detection mechanism.",
+			"documentation_url": "https://developer.github.com/v3/#abuse-rate-limits",
+		})
+		return true
+	}
+	writeJSON(w, e.code, map[string]string{"message": "injected error"})
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// paginate returns the page of items asked for by the page and per_page
+// parameters, and sets the Link header if there are more pages.
+func paginate(req *request, n int) (start, end int) {
+	q := req.r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(q.Get("per_page"))
+	if perPage < 1 {
+		perPage = 30
+	}
+	// Like github, at most 100 items are returned per page.
+	if perPage > 100 {
+		perPage = 100
+	}
+	start = (page - 1) * perPage
+	if start > n {
+		start = n
+	}
+	end = start + perPage
+	if end > n {
+		end = n
+	}
+	if end < n {
+		u := *req.r.URL
+		q.Set("page", strconv.Itoa(page+1))
+		u.RawQuery = q.Encode()
+		req.w.Header().Set("Link", fmt.Sprintf(`<http://%v%v>; rel="next"`, req.r.Host, u.String()))
+	}
+	return start, end
+}
+
+func (s *Server) getUser(req *request) (interface{}, error) {
+	if s.user == nil {
+		return nil, notFound("no user set")
+	}
+	return s.user, nil
+}
+
+func (s *Server) getEmails(req *request) (interface{}, error) {
+	return s.emails, nil
+}
+
+func (s *Server) listOrgMembers(req *request) (interface{}, error) {
+	members := s.orgMembers[req.args[0]]
+	start, end := paginate(req, len(members))
+	ret := []*github.User{}
+	for _, m := range members[start:end] {
+		ret = append(ret, &github.User{Login: github.String(m)})
+	}
+	return ret, nil
+}
+
+func (s *Server) listMilestones(req *request) (interface{}, error) {
+	r, err := req.repo(s)
+	if err != nil {
+		return nil, err
+	}
+	start, end := paginate(req, len(r.milestones))
+	return r.milestones[start:end], nil
+}
+
+func (s *Server) listIssues(req *request) (interface{}, error) {
+	r, err := req.repo(s)
+	if err != nil {
+		return nil, err
+	}
+	q := req.r.URL.Query()
+	state := q.Get("state")
+	milestone := q.Get("milestone")
+	var labels []string
+	if l := q.Get("labels"); l != "" {
+		labels = strings.Split(l, ",")
+	}
+
+	ret := []*github.Issue{}
+	for _, i := range r.issues {
+		if state != "" && state != "all" && i.GetState() != state {
+			continue
+		}
+		if milestone != "" && milestone != "*" && strconv.Itoa(i.GetMilestone().GetNumber()) != milestone {
+			continue
+		}
+		if !hasLabels(i, labels) {
+			continue
+		}
+		ret = append(ret, i)
+	}
+	start, end := paginate(req, len(ret))
+	return ret[start:end], nil
+}
+
+func hasLabels(i *github.Issue, labels []string) bool {
+	for _, want := range labels {
+		found := false
+		for _, l := range i.Labels {
+			if l.GetName() == want {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// number returns the issue or PR number from the third arg.
+func (req *request) number() (int, error) {
+	num, err := strconv.Atoi(req.args[2])
+	if err != nil {
+		return 0, notFound("invalid number %q", req.args[2])
+	}
+	return num, nil
+}
+
+func (s *Server) getIssue(req *request) (interface{}, error) {
+	r, err := req.repo(s)
+	if err != nil {
+		return nil, err
+	}
+	num, err := req.number()
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range r.issues {
+		if i.GetNumber() == num {
+			return i, nil
+		}
+	}
+	return nil, notFound("issue %v doesn't exist", num)
+}
+
+func (s *Server) listIssueEvents(req *request) (interface{}, error) {
+	r, err := req.repo(s)
+	if err != nil {
+		return nil, err
+	}
+	num, err := req.number()
+	if err != nil {
+		return nil, err
+	}
+	events := r.events[num]
+	start, end := paginate(req, len(events))
+	ret := []*github.IssueEvent{}
+	return append(ret, events[start:end]...), nil
+}
+
+func newReference(name plumbing.ReferenceName, h plumbing.Hash) *github.Reference {
+	return &github.Reference{
+		Ref: github.String(name.String()),
+		Object: &github.GitObject{
+			Type: github.String("commit"),
+			SHA:  github.String(h.String()),
+		},
+	}
+}
+
+func (s *Server) getRef(req *request) (interface{}, error) {
+	if _, err := req.repo(s); err != nil {
+		return nil, err
+	}
+	name := plumbing.NewBranchReferenceName(req.args[2])
+	ref, err := s.storage(req.args[0], req.args[1]).Reference(name)
+	if err != nil {
+		return nil, notFound("ref %v doesn't exist", name)
+	}
+	return newReference(name, ref.Hash()), nil
+}
+
+func (s *Server) updateRef(req *request) (interface{}, error) {
+	if _, err := req.repo(s); err != nil {
+		return nil, err
+	}
+	var body struct {
+		SHA   string `json:"sha"`
+		Force bool   `json:"force"`
+	}
+	if err := json.NewDecoder(req.r.Body).Decode(&body); err != nil {
+		return nil, badRequest("invalid body: %v", err)
+	}
+	owner, name := req.args[0], req.args[1]
+	refName := plumbing.NewBranchReferenceName(req.args[2])
+	st := s.storage(owner, name)
+	old, err := st.Reference(refName)
+	if err != nil {
+		return nil, notFound("ref %v doesn't exist", refName)
+	}
+	h, err := s.resolve(owner, name, body.SHA)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	if !body.Force {
+		// A fast-forward only adds commits on top of the old ref.
+		dropped, _, err := s.commitsBetween(owner, name, h.String(), old.Hash().String())
+		if err != nil {
+			return nil, err
+		}
+		if len(dropped) > 0 {
+			return nil, badRequest("update is not a fast forward")
+		}
+	}
+	if err := st.SetReference(plumbing.NewHashReference(refName, h)); err != nil {
+		return nil, err
+	}
+	return newReference(refName, h), nil
+}
+
+func (s *Server) createRef(req *request) (interface{}, error) {
+	if _, err := req.repo(s); err != nil {
+		return nil, err
+	}
+	var body struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	}
+	if err := json.NewDecoder(req.r.Body).Decode(&body); err != nil {
+		return nil, badRequest("invalid body: %v", err)
+	}
+	// go-github sends the ref without "refs/".
+	name := plumbing.ReferenceName("refs/" + strings.TrimPrefix(body.Ref, "refs/"))
+	st := s.storage(req.args[0], req.args[1])
+	if _, err := st.Reference(name); err == nil {
+		return nil, badRequest("reference %v already exists", name)
+	}
+	h, err := s.resolve(req.args[0], req.args[1], body.SHA)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	if err := st.SetReference(plumbing.NewHashReference(name, h)); err != nil {
+		return nil, err
+	}
+	return newReference(name, h), nil
+}
+
+func (s *Server) createPR(req *request) (interface{}, error) {
+	r, err := req.repo(s)
+	if err != nil {
+		return nil, err
+	}
+	var body github.NewPullRequest
+	if err := json.NewDecoder(req.r.Body).Decode(&body); err != nil {
+		return nil, badRequest("invalid body: %v", err)
+	}
+	headUser, headBranch := r.owner, body.GetHead()
+	if i := strings.Index(headBranch, ":"); i >= 0 {
+		headUser, headBranch = headBranch[:i], headBranch[i+1:]
+	}
+	if s.getRepo(headUser, r.name) == nil {
+		return nil, badRequest("head repo %v/%v doesn't exist", headUser, r.name)
+	}
+	headHash, err := s.resolve(headUser, r.name, headBranch)
+	if err != nil {
+		return nil, badRequest("head %v: %v", body.GetHead(), err)
+	}
+	if _, err := s.storage(r.owner, r.name).Reference(plumbing.NewBranchReferenceName(body.GetBase())); err != nil {
+		return nil, badRequest("base branch %v doesn't exist", body.GetBase())
+	}
+	for _, pr := range r.pulls {
+		if pr.GetState() == "open" && pr.GetHead().GetLabel() == headUser+":"+headBranch && pr.GetBase().GetRef() == body.GetBase() {
+			return nil, badRequest("a pull request already exists for %v:%v", headUser, headBranch)
+		}
+	}
+
+	num := r.nextNumber
+	r.nextNumber++
+	pr := &github.PullRequest{
+		Number:  github.Int(num),
+		Title:   body.Title,
+		Body:    body.Body,
+		State:   github.String("open"),
+		Merged:  github.Bool(false),
+		HTMLURL: github.String(s.htmlURL(r.owner, r.name, "pull", num)),
+		User:    s.user,
+		Head: &github.PullRequestBranch{
+			Label: github.String(headUser + ":" + headBranch),
+			Ref:   github.String(headBranch),
+			SHA:   github.String(headHash.String()),
+		},
+		Base: &github.PullRequestBranch{
+			Ref: body.Base,
+		},
+	}
+	if s.AutoMerge {
+		pr.State = github.String("closed")
+		pr.Merged = github.Bool(true)
+		pr.MergedAt = timePtr(time.Now())
+	}
+	r.pulls[num] = pr
+	return pr, nil
+}
+
+// listPRs returns the PRs, filtered by the state, head and base, like github.
+// The head must be in the form user:branch.
+func (s *Server) listPRs(req *request) (interface{}, error) {
+	r, err := req.repo(s)
+	if err != nil {
+		return nil, err
+	}
+	q := req.r.URL.Query()
+	state := q.Get("state")
+	if state == "" {
+		state = "open"
+	}
+	var prs []*github.PullRequest
+	for i := 1; i < r.nextNumber; i++ {
+		pr, ok := r.pulls[i]
+		if !ok || (state != "all" && pr.GetState() != state) {
+			continue
+		}
+		if head := q.Get("head"); head != "" && pr.GetHead().GetLabel() != head {
+			continue
+		}
+		if base := q.Get("base"); base != "" && pr.GetBase().GetRef() != base {
+			continue
+		}
+		prs = append(prs, pr)
+	}
+	start, end := paginate(req, len(prs))
+	ret := []*github.PullRequest{}
+	return append(ret, prs[start:end]...), nil
+}
+
+func (s *Server) getPR(req *request) (interface{}, error) {
+	r, err := req.repo(s)
+	if err != nil {
+		return nil, err
+	}
+	num, err := req.number()
+	if err != nil {
+		return nil, err
+	}
+	pr, ok := r.pulls[num]
+	if !ok {
+		return nil, notFound("PR %v doesn't exist", num)
+	}
+	return pr, nil
+}
+
+// listPRsForCommit returns the merged PRs with the commit as their merge
+// commit. Unlike github, open PRs with the commit are not returned.
+func (s *Server) listPRsForCommit(req *request) (interface{}, error) {
+	r, err := req.repo(s)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*github.PullRequest{}
+	for i := 1; i < r.nextNumber; i++ {
+		if pr, ok := r.pulls[i]; ok && pr.GetMerged() && pr.GetMergeCommitSHA() == req.args[2] {
+			ret = append(ret, pr)
+		}
+	}
+	return ret, nil
+}
+
+// getCombinedStatus returns no statuses, the fake has no CI.
+func (s *Server) getCombinedStatus(req *request) (interface{}, error) {
+	return &github.CombinedStatus{
+		State:    github.String("success"),
+		SHA:      github.String(req.args[2]),
+		Statuses: []github.RepoStatus{},
+	}, nil
+}
+
+// listCheckRuns returns no check runs, the fake has no CI.
+func (s *Server) listCheckRuns(req *request) (interface{}, error) {
+	return &github.ListCheckRunsResults{
+		Total:     github.Int(0),
+		CheckRuns: []*github.CheckRun{},
+	}, nil
+}
+
+func (s *Server) listReleases(req *request) (interface{}, error) {
+	r, err := req.repo(s)
+	if err != nil {
+		return nil, err
+	}
+	start, end := paginate(req, len(r.releases))
+	ret := []*github.RepositoryRelease{}
+	return append(ret, r.releases[start:end]...), nil
+}
+
+func (s *Server) createRelease(req *request) (interface{}, error) {
+	r, err := req.repo(s)
+	if err != nil {
+		return nil, err
+	}
+	var rel github.RepositoryRelease
+	if err := json.NewDecoder(req.r.Body).Decode(&rel); err != nil {
+		return nil, badRequest("invalid body: %v", err)
+	}
+	for _, old := range r.releases {
+		if old.GetTagName() == rel.GetTagName() {
+			return nil, badRequest("release with tag %v already exists", rel.GetTagName())
+		}
+	}
+	if rel.TargetCommitish == nil {
+		rel.TargetCommitish = github.String("master")
+	}
+	if _, err := s.resolve(r.owner, r.name, rel.GetTargetCommitish()); err != nil {
+		return nil, badRequest("target %v: %v", rel.GetTargetCommitish(), err)
+	}
+	rel.ID = github.Int64(int64(len(r.releases) + 1))
+	rel.HTMLURL = github.String(s.htmlURL(r.owner, r.name, "releases", "tag", rel.GetTagName()))
+	r.releases = append(r.releases, &rel)
+	if s.AutoPublish {
+		if err := s.publish(r, &rel); err != nil {
+			return nil, err
+		}
+	}
+	return &rel, nil
+}
+
+// editRelease updates the fields set in the body. Setting draft to false
+// publishes the release, and creates its tag.
+func (s *Server) editRelease(req *request) (interface{}, error) {
+	r, err := req.repo(s)
+	if err != nil {
+		return nil, err
+	}
+	id, err := req.number()
+	if err != nil {
+		return nil, err
+	}
+	if id < 1 || id > len(r.releases) {
+		return nil, notFound("release %v doesn't exist", id)
+	}
+	rel := r.releases[id-1]
+	var body github.RepositoryRelease
+	if err := json.NewDecoder(req.r.Body).Decode(&body); err != nil {
+		return nil, badRequest("invalid body: %v", err)
+	}
+	if body.Name != nil {
+		rel.Name = body.Name
+	}
+	if body.Body != nil {
+		rel.Body = body.Body
+	}
+	if body.TargetCommitish != nil {
+		rel.TargetCommitish = body.TargetCommitish
+	}
+	if body.Prerelease != nil {
+		rel.Prerelease = body.Prerelease
+	}
+	if rel.GetDraft() && body.Draft != nil && !body.GetDraft() {
+		if err := s.publish(r, rel); err != nil {
+			return nil, err
+		}
+	}
+	return rel, nil
+}
+
+func (s *Server) listTags(req *request) (interface{}, error) {
+	if _, err := req.repo(s); err != nil {
+		return nil, err
+	}
+	refs, err := s.storage(req.args[0], req.args[1]).IterReferences()
+	if err != nil {
+		return nil, err
+	}
+	var tags []*github.RepositoryTag
+	if err := refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name().IsTag() {
+			tags = append(tags, &github.RepositoryTag{
+				Name:   github.String(ref.Name().Short()),
+				Commit: &github.Commit{SHA: github.String(ref.Hash().String())},
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	start, end := paginate(req, len(tags))
+	ret := []*github.RepositoryTag{}
+	return append(ret, tags[start:end]...), nil
+}
+
+func (s *Server) getCommit(req *request) (interface{}, error) {
+	if _, err := req.repo(s); err != nil {
+		return nil, err
+	}
+	h, err := s.resolve(req.args[0], req.args[1], req.args[2])
+	if err != nil {
+		return nil, notFound("%v", err)
+	}
+	c, err := object.GetCommit(s.storage(req.args[0], req.args[1]), h)
+	if err != nil {
+		return nil, err
+	}
+	return &github.RepositoryCommit{
+		SHA: github.String(h.String()),
+		Commit: &github.Commit{
+			SHA:       github.String(h.String()),
+			Message:   github.String(c.Message),
+			Author:    &github.CommitAuthor{Name: github.String(c.Author.Name), Email: github.String(c.Author.Email), Date: &c.Author.When},
+			Committer: &github.CommitAuthor{Name: github.String(c.Committer.Name), Email: github.String(c.Committer.Email), Date: &c.Committer.When},
+		},
+	}, nil
+}
+
+// searchIssues supports the searches for the merged PRs of a user: the
+// qualifiers repo, is:pr, is:merged, author and merged:<time.
+func (s *Server) searchIssues(req *request) (interface{}, error) {
+	var (
+		r            *repo
+		onlyPRs      bool
+		onlyMerged   bool
+		author       string
+		mergedBefore time.Time
+	)
+	for _, q := range strings.Fields(req.r.URL.Query().Get("q")) {
+		kv := strings.SplitN(q, ":", 2)
+		if len(kv) != 2 {
+			return nil, badRequest("unsupported search term %q", q)
+		}
+		switch k, v := kv[0], kv[1]; {
+		case k == "repo":
+			ownerName := strings.SplitN(v, "/", 2)
+			if len(ownerName) != 2 {
+				return nil, badRequest("invalid repo %q", v)
+			}
+			if r = s.getRepo(ownerName[0], ownerName[1]); r == nil {
+				return nil, badRequest("repo %q not found", v)
+			}
+		case q == "is:pr":
+			onlyPRs = true
+		case q == "is:merged":
+			onlyMerged = true
+		case k == "author":
+			author = v
+		case k == "merged" && strings.HasPrefix(v, "<"):
+			t, err := time.Parse(time.RFC3339, v[1:])
+			if err != nil {
+				return nil, badRequest("invalid time %q", v[1:])
+			}
+			mergedBefore = t
+		default:
+			return nil, badRequest("unsupported search qualifier %q", q)
+		}
+	}
+	if r == nil {
+		return nil, badRequest("search without a repo is not supported")
+	}
+
+	ret := &github.IssuesSearchResult{Issues: []github.Issue{}}
+	for _, i := range r.issues {
+		pr := r.pulls[i.GetNumber()]
+		if onlyPRs && pr == nil {
+			continue
+		}
+		if onlyMerged && !pr.GetMerged() {
+			continue
+		}
+		if author != "" && i.GetUser().GetLogin() != author {
+			continue
+		}
+		if !mergedBefore.IsZero() && (!pr.GetMerged() || !pr.GetMergedAt().Before(mergedBefore)) {
+			continue
+		}
+		ret.Issues = append(ret.Issues, *i)
+	}
+	ret.Total = github.Int(len(ret.Issues))
+	start, end := paginate(req, len(ret.Issues))
+	ret.Issues = ret.Issues[start:end]
+	return ret, nil
+}
+
+// listCommits returns the commits of the sha param, or master, newest first.
+// Unlike github, they are in the order of the history, not by date.
+func (s *Server) listCommits(req *request) (interface{}, error) {
+	if _, err := req.repo(s); err != nil {
+		return nil, err
+	}
+	head := req.r.URL.Query().Get("sha")
+	if head == "" {
+		head = "master"
+	}
+	h, err := s.resolve(req.args[0], req.args[1], head)
+	if err != nil {
+		return nil, notFound("%v", err)
+	}
+	c, err := object.GetCommit(s.storage(req.args[0], req.args[1]), h)
+	if err != nil {
+		return nil, err
+	}
+	var commits []*github.RepositoryCommit
+	if err := object.NewCommitPreorderIter(c, nil, nil).ForEach(func(c *object.Commit) error {
+		commits = append(commits, &github.RepositoryCommit{
+			SHA:    github.String(c.Hash.String()),
+			Commit: &github.Commit{Message: github.String(c.Message)},
+		})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	start, end := paginate(req, len(commits))
+	ret := []*github.RepositoryCommit{}
+	return append(ret, commits[start:end]...), nil
+}
+
+// maxCompareCommits is the most commits github returns in a comparison.
+const maxCompareCommits = 250
+
+func (s *Server) compare(req *request) (interface{}, error) {
+	if _, err := req.repo(s); err != nil {
+		return nil, err
+	}
+	revs := strings.SplitN(req.args[2], "...", 2)
+	if len(revs) != 2 {
+		return nil, notFound("invalid comparison %q", req.args[2])
+	}
+	commits, mergeBase, err := s.commitsBetween(req.args[0], req.args[1], revs[0], revs[1])
+	if err != nil {
+		return nil, notFound("%v", err)
+	}
+	ret := &github.CommitsComparison{
+		TotalCommits:    github.Int(len(commits)),
+		MergeBaseCommit: &github.RepositoryCommit{SHA: github.String(mergeBase.String())},
+		Commits:         []github.RepositoryCommit{},
+	}
+	if len(commits) > maxCompareCommits {
+		commits = commits[:maxCompareCommits]
+	}
+	for _, c := range commits {
+		ret.Commits = append(ret.Commits, github.RepositoryCommit{
+			SHA:    github.String(c.Hash.String()),
+			Commit: &github.Commit{Message: github.String(c.Message)},
+		})
+	}
+	return ret, nil
+}
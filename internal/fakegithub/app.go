@@ -0,0 +1,153 @@
+package fakegithub
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// app is a github app installed in the fake.
+type app struct {
+	id             int64
+	installationID int64
+	slug           string
+	key            *rsa.PublicKey
+	botID          int64
+	// tokens are the expiry times of the installation tokens, by token.
+	tokens map[string]time.Time
+}
+
+// installationTokenPrefix is the prefix of the installation tokens, like
+// github's.
+const installationTokenPrefix = "ghs_"
+
+// SetApp installs a github app. Installation tokens are created for JWTs
+// signed with the private key of key.
+func (s *Server) SetApp(id, installationID int64, slug string, key *rsa.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.app = &app{id: id, installationID: installationID, slug: slug, key: key, botID: 40000 + id, tokens: make(map[string]time.Time)}
+}
+
+// isJWT returns whether the Authorization header has a JWT, three base64
+// parts separated by dots, instead of a token.
+func isJWT(authorization string) bool {
+	parts := strings.Fields(authorization)
+	return len(parts) == 2 && strings.Count(parts[1], ".") == 2
+}
+
+// checkGitToken checks the token can be used for git. Installation tokens
+// must have been created by the app, and not be expired. s.mu must be held.
+func (s *Server) checkGitToken(token string) error {
+	if isJWT("Bearer " + token) {
+		return transport.ErrAuthorizationFailed
+	}
+	if !strings.HasPrefix(token, installationTokenPrefix) {
+		return nil
+	}
+	if s.app == nil {
+		return transport.ErrAuthorizationFailed
+	}
+	if exp, ok := s.app.tokens[token]; !ok || time.Now().After(exp) {
+		return transport.ErrAuthorizationFailed
+	}
+	return nil
+}
+
+// checkJWT checks the request is authenticated with a valid JWT of the app.
+// s.mu must be held.
+func (s *Server) checkJWT(req *request) error {
+	if s.app == nil {
+		return notFound("no app set")
+	}
+	unauthorized := func(format string, a ...interface{}) error {
+		return &httpError{code: http.StatusUnauthorized, msg: fmt.Sprintf(format, a...)}
+	}
+	jwt := strings.TrimPrefix(req.r.Header.Get("Authorization"), "Bearer ")
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return unauthorized("invalid JWT %q", jwt)
+	}
+	enc := base64.RawURLEncoding
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return unauthorized("invalid JWT signature: %v", err)
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(s.app.key, crypto.SHA256, hash[:], sig); err != nil {
+		return unauthorized("JWT signature doesn't match the app's key: %v", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if b, err := enc.DecodeString(parts[0]); err != nil || json.Unmarshal(b, &header) != nil || header.Alg != "RS256" {
+		return unauthorized("invalid JWT header")
+	}
+	var claims struct {
+		Iat int64 `json:"iat"`
+		Exp int64 `json:"exp"`
+		Iss int64 `json:"iss"`
+	}
+	if b, err := enc.DecodeString(parts[1]); err != nil || json.Unmarshal(b, &claims) != nil {
+		return unauthorized("invalid JWT claims")
+	}
+	now := time.Now().Unix()
+	if claims.Iss != s.app.id {
+		return unauthorized("JWT is for app %v, not %v", claims.Iss, s.app.id)
+	}
+	if claims.Iat > now || claims.Exp < now || claims.Exp-claims.Iat > 11*60 {
+		return unauthorized("JWT is expired or valid for too long")
+	}
+	return nil
+}
+
+func (s *Server) getApp(req *request) (interface{}, error) {
+	if err := s.checkJWT(req); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"id": s.app.id, "slug": s.app.slug}, nil
+}
+
+func (s *Server) createInstallationToken(req *request) (interface{}, error) {
+	if err := s.checkJWT(req); err != nil {
+		return nil, err
+	}
+	if req.args[0] != fmt.Sprint(s.app.installationID) {
+		return nil, notFound("installation %v doesn't exist", req.args[0])
+	}
+	lifetime := s.AppTokenLifetime
+	if lifetime == 0 {
+		lifetime = time.Hour
+	}
+	token := fmt.Sprintf("%vfake_%v", installationTokenPrefix, len(s.app.tokens)+1)
+	exp := time.Now().Add(lifetime)
+	s.app.tokens[token] = exp
+	return map[string]interface{}{
+		"token":      token,
+		"expires_at": exp.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// getUserByLogin returns the app's bot user, or a user with a made up ID.
+func (s *Server) getUserByLogin(req *request) (interface{}, error) {
+	login := req.args[0]
+	if s.app != nil && login == s.app.slug+"[bot]" {
+		return map[string]interface{}{"login": login, "id": s.app.botID, "type": "Bot"}, nil
+	}
+	var id int64
+	for _, c := range login {
+		id = id*31 + int64(c)
+	}
+	if id < 0 {
+		id = -id
+	}
+	return map[string]interface{}{"login": login, "id": id, "type": "User"}, nil
+}
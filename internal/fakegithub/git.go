@@ -0,0 +1,292 @@
+package fakegithub
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// commitTime is the time of all the commits made by Commit, so the same
+// commits made in different repos have the same hash.
+var commitTime = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// CreateRepo creates a repo with one commit on master with the files.
+func (s *Server) CreateRepo(owner, name string, files map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.getRepo(owner, name) != nil {
+		return fmt.Errorf("repo %v/%v already exists", owner, name)
+	}
+	if _, err := git.PlainInit(s.repoPath(owner, name), true); err != nil {
+		return fmt.Errorf("failed to init repo: %v", err)
+	}
+	s.repos[owner+"/"+name] = newRepo(owner, name)
+	_, err := s.commit(owner, name, "master", "Initial commit", files)
+	return err
+}
+
+// Fork copies the repo owner/name to newOwner/name, including all branches.
+func (s *Server) Fork(owner, name, newOwner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.mustGetRepo(owner, name); err != nil {
+		return err
+	}
+	if s.getRepo(newOwner, name) != nil {
+		return fmt.Errorf("repo %v/%v already exists", newOwner, name)
+	}
+	if err := copyDir(s.repoPath(owner, name), s.repoPath(newOwner, name)); err != nil {
+		return fmt.Errorf("failed to copy repo: %v", err)
+	}
+	s.repos[newOwner+"/"+name] = newRepo(newOwner, name)
+	return nil
+}
+
+func newRepo(owner, name string) *repo {
+	return &repo{
+		owner:      owner,
+		name:       name,
+		events:     make(map[int][]*github.IssueEvent),
+		pulls:      make(map[int]*github.PullRequest),
+		nextNumber: 1,
+	}
+}
+
+// Commit commits the files to the branch, creating the branch from master if
+// it doesn't exist. It returns the commit hash.
+func (s *Server) Commit(owner, name, branch, message string, files map[string]string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.mustGetRepo(owner, name); err != nil {
+		return "", err
+	}
+	return s.commit(owner, name, branch, message, files)
+}
+
+func (s *Server) commit(owner, name, branch, message string, files map[string]string) (string, error) {
+	st := s.storage(owner, name)
+	fs := memfs.New()
+	r, err := git.Open(st, fs)
+	if err != nil {
+		return "", err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return "", err
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(branch)
+	if _, err := r.Head(); err == nil {
+		// Not an empty repo. The worktree is a new memfs, so the checkout is
+		// forced to not fail on the files missing from it.
+		opts := &git.CheckoutOptions{Branch: branchRef, Force: true}
+		if _, err := r.Reference(branchRef, false); err != nil {
+			master, err := r.Reference(plumbing.Master, false)
+			if err != nil {
+				return "", err
+			}
+			opts.Create = true
+			opts.Hash = master.Hash()
+		}
+		if err := w.Checkout(opts); err != nil {
+			return "", fmt.Errorf("failed to checkout %v: %v", branch, err)
+		}
+	}
+
+	for path, content := range files {
+		if err := fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+		f, err := fs.Create(path)
+		if err != nil {
+			return "", err
+		}
+		f.Write([]byte(content))
+		f.Close()
+		if _, err := w.Add(path); err != nil {
+			return "", err
+		}
+	}
+	sig := &object.Signature{Name: "fakegithub", Email: "fakegithub@example.com", When: commitTime}
+	h, err := w.Commit(message, &git.CommitOptions{Author: sig, Committer: sig})
+	if err != nil {
+		return "", fmt.Errorf("failed to commit: %v", err)
+	}
+	// The bare repo's HEAD stays on master.
+	if err := st.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Master)); err != nil {
+		return "", err
+	}
+	return h.String(), nil
+}
+
+// Tag creates the tag at rev, a branch, tag or hash, like an earlier release.
+func (s *Server) Tag(owner, name, tag, rev string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.mustGetRepo(owner, name); err != nil {
+		return err
+	}
+	h, err := s.resolve(owner, name, rev)
+	if err != nil {
+		return err
+	}
+	return s.storage(owner, name).SetReference(plumbing.NewHashReference(plumbing.NewTagReferenceName(tag), h))
+}
+
+// File returns the content of the file at path on the branch.
+func (s *Server) File(owner, name, branch, path string) (string, error) {
+	r, err := git.Open(s.storage(owner, name), nil)
+	if err != nil {
+		return "", err
+	}
+	ref, err := r.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		return "", fmt.Errorf("branch %v: %v", branch, err)
+	}
+	c, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return "", err
+	}
+	f, err := c.File(path)
+	if err != nil {
+		return "", fmt.Errorf("%v on %v: %v", path, branch, err)
+	}
+	return f.Contents()
+}
+
+// Branches returns the names of the branches in the repo.
+func (s *Server) Branches(owner, name string) ([]string, error) {
+	refs, err := s.storage(owner, name).IterReferences()
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	err = refs.ForEach(func(r *plumbing.Reference) error {
+		if r.Name().IsBranch() {
+			ret = append(ret, r.Name().Short())
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// storage opens the bare repo's storage. It's opened for every use, because
+// pushes through the fake git protocol write to the repo with their own
+// storage.
+func (s *Server) storage(owner, name string) *filesystem.Storage {
+	return filesystem.NewStorage(osfs.New(s.repoPath(owner, name)), cache.NewObjectLRUDefault())
+}
+
+// resolve returns the commit hash for a branch, tag or hash.
+func (s *Server) resolve(owner, name, rev string) (plumbing.Hash, error) {
+	st := s.storage(owner, name)
+	for _, n := range []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(rev),
+		plumbing.NewTagReferenceName(rev),
+	} {
+		if ref, err := storer.ResolveReference(st, n); err == nil {
+			return ref.Hash(), nil
+		}
+	}
+	h := plumbing.NewHash(rev)
+	if _, err := object.GetCommit(st, h); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("%v not found", rev)
+	}
+	return h, nil
+}
+
+// commitsBetween returns the commits reachable from head but not from base,
+// oldest first, and the merge base of base and head.
+func (s *Server) commitsBetween(owner, name, base, head string) ([]*object.Commit, plumbing.Hash, error) {
+	baseHash, err := s.resolve(owner, name, base)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	headHash, err := s.resolve(owner, name, head)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	st := s.storage(owner, name)
+
+	inBase := make(map[plumbing.Hash]bool)
+	baseCommit, err := object.GetCommit(st, baseHash)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	if err := object.NewCommitPreorderIter(baseCommit, nil, nil).ForEach(func(c *object.Commit) error {
+		inBase[c.Hash] = true
+		return nil
+	}); err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+
+	headCommit, err := object.GetCommit(st, headHash)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	var ret []*object.Commit
+	if err := object.NewCommitPreorderIter(headCommit, inBase, nil).ForEach(func(c *object.Commit) error {
+		ret = append([]*object.Commit{c}, ret...)
+		return nil
+	}); err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	// The first commit of head in base is the merge base.
+	var mergeBase plumbing.Hash
+	if err := object.NewCommitPreorderIter(headCommit, nil, nil).ForEach(func(c *object.Commit) error {
+		if inBase[c.Hash] {
+			mergeBase = c.Hash
+			return storer.ErrStop
+		}
+		return nil
+	}); err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	return ret, mergeBase, nil
+}
+
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode())
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, b, info.Mode())
+	})
+}
+
+// Author returns the author of the head commit of the branch.
+func (s *Server) Author(owner, name, branch string) (string, string, error) {
+	h, err := s.resolve(owner, name, branch)
+	if err != nil {
+		return "", "", err
+	}
+	c, err := object.GetCommit(s.storage(owner, name), h)
+	if err != nil {
+		return "", "", err
+	}
+	return c.Author.Name, c.Author.Email, nil
+}
@@ -0,0 +1,246 @@
+package fakegithub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// PR describes a pull request to be added with AddPR.
+type PR struct {
+	Title  string
+	Body   string
+	Author string
+	Labels []string
+	// Milestone is the title of the milestone. It's created if it doesn't
+	// exist.
+	Milestone string
+	// Merged PRs are closed, and have a merged event with MergeCommit. Other
+	// PRs are closed without merging.
+	Merged      bool
+	MergeCommit string
+	// MergedAt is when the PR was merged and closed. If zero, it's a time after
+	// the commits made by Commit, in 2018.
+	MergedAt time.Time
+}
+
+// AddMilestone creates a milestone if it doesn't exist, and returns its
+// number.
+func (s *Server) AddMilestone(owner, name, title string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.mustGetRepo(owner, name)
+	if err != nil {
+		return 0, err
+	}
+	return r.milestone(title).GetNumber(), nil
+}
+
+// milestone returns the milestone with the title, creating it if it doesn't
+// exist.
+func (r *repo) milestone(title string) *github.Milestone {
+	for _, m := range r.milestones {
+		if m.GetTitle() == title {
+			return m
+		}
+	}
+	m := &github.Milestone{
+		ID:           github.Int64(int64(1000 + len(r.milestones))),
+		Number:       github.Int(len(r.milestones) + 1),
+		Title:        github.String(title),
+		State:        github.String("open"),
+		OpenIssues:   github.Int(0),
+		ClosedIssues: github.Int(0),
+	}
+	r.milestones = append(r.milestones, m)
+	return m
+}
+
+// AddPR adds a closed pull request, and returns its number.
+func (s *Server) AddPR(owner, name string, pr *PR) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.mustGetRepo(owner, name)
+	if err != nil {
+		return 0, err
+	}
+	num := r.nextNumber
+	r.nextNumber++
+
+	issue := r.newClosedIssue(num, pr.Title, pr.Body, pr.Author, pr.Labels, pr.Milestone)
+	if !pr.MergedAt.IsZero() {
+		issue.ClosedAt = timePtr(pr.MergedAt)
+	}
+	issue.HTMLURL = github.String(s.htmlURL(owner, name, "pull", num))
+	issue.PullRequestLinks = &github.PullRequestLinks{
+		HTMLURL: github.String(s.htmlURL(owner, name, "pull", num)),
+	}
+	r.issues = append(r.issues, issue)
+
+	r.events[num] = append(r.events[num], &github.IssueEvent{Event: github.String("closed")})
+	if pr.Merged {
+		r.events[num] = append(r.events[num], &github.IssueEvent{
+			Event:    github.String("merged"),
+			CommitID: github.String(pr.MergeCommit),
+		})
+	}
+	r.pulls[num] = &github.PullRequest{
+		Number:         github.Int(num),
+		Title:          github.String(pr.Title),
+		Body:           github.String(pr.Body),
+		State:          github.String("closed"),
+		Merged:         github.Bool(pr.Merged),
+		MergeCommitSHA: github.String(pr.MergeCommit),
+		HTMLURL:        issue.HTMLURL,
+		User:           issue.User,
+	}
+	if pr.Merged {
+		r.pulls[num].MergedAt = issue.ClosedAt
+	}
+	return num, nil
+}
+
+// SetMergeCommit sets the merge commit of a merged PR added with AddPR, e.g. a
+// commit made with Commit after the PR. The commit is then associated with the
+// PR, like github does for the commits that merged PRs.
+func (s *Server) SetMergeCommit(owner, name string, number int, sha string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.mustGetRepo(owner, name)
+	if err != nil {
+		return err
+	}
+	pr, ok := r.pulls[number]
+	if !ok || !pr.GetMerged() {
+		return fmt.Errorf("PR %v/%v#%v doesn't exist or is not merged", owner, name, number)
+	}
+	pr.MergeCommitSHA = github.String(sha)
+	for _, e := range r.events[number] {
+		if e.GetEvent() == "merged" {
+			e.CommitID = github.String(sha)
+		}
+	}
+	return nil
+}
+
+// AddIssue adds a closed issue that is not a pull request, and returns its
+// number.
+func (s *Server) AddIssue(owner, name, title, milestone string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.mustGetRepo(owner, name)
+	if err != nil {
+		return 0, err
+	}
+	num := r.nextNumber
+	r.nextNumber++
+	issue := r.newClosedIssue(num, title, "", "fakegithub", nil, milestone)
+	issue.HTMLURL = github.String(s.htmlURL(owner, name, "issues", num))
+	r.issues = append(r.issues, issue)
+	return num, nil
+}
+
+func (r *repo) newClosedIssue(num int, title, body, author string, labels []string, milestone string) *github.Issue {
+	issue := &github.Issue{
+		Number:   github.Int(num),
+		Title:    github.String(title),
+		Body:     github.String(body),
+		State:    github.String("closed"),
+		ClosedAt: timePtr(commitTime.Add(time.Duration(num) * time.Minute)),
+		User: &github.User{
+			Login:   github.String(author),
+			HTMLURL: github.String("https://github.com/" + author),
+		},
+	}
+	for _, l := range labels {
+		issue.Labels = append(issue.Labels, github.Label{Name: github.String(l)})
+	}
+	if milestone != "" {
+		m := r.milestone(milestone)
+		m.ClosedIssues = github.Int(m.GetClosedIssues() + 1)
+		issue.Milestone = m
+	}
+	return issue
+}
+
+// PullRequests returns the pull requests created with the API.
+func (s *Server) PullRequests(owner, name string) []*github.PullRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.getRepo(owner, name)
+	if r == nil {
+		return nil
+	}
+	var ret []*github.PullRequest
+	for i := 1; i < r.nextNumber; i++ {
+		if pr, ok := r.pulls[i]; ok && pr.Head != nil {
+			ret = append(ret, pr)
+		}
+	}
+	return ret
+}
+
+// MergePR marks the pull request as merged. The branch is not merged in git.
+func (s *Server) MergePR(owner, name string, number int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.mustGetRepo(owner, name)
+	if err != nil {
+		return err
+	}
+	pr, ok := r.pulls[number]
+	if !ok {
+		return fmt.Errorf("PR %v/%v#%v doesn't exist", owner, name, number)
+	}
+	pr.Merged = github.Bool(true)
+	pr.MergedAt = timePtr(time.Now())
+	pr.State = github.String("closed")
+	return nil
+}
+
+// Releases returns the releases, drafts included.
+func (s *Server) Releases(owner, name string) []*github.RepositoryRelease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.getRepo(owner, name)
+	if r == nil {
+		return nil
+	}
+	return append([]*github.RepositoryRelease(nil), r.releases...)
+}
+
+// PublishRelease publishes the draft release with the tag, and creates the tag
+// at the head of the release's target branch.
+func (s *Server) PublishRelease(owner, name, tagName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.mustGetRepo(owner, name)
+	if err != nil {
+		return err
+	}
+	for _, rel := range r.releases {
+		if rel.GetTagName() == tagName {
+			return s.publish(r, rel)
+		}
+	}
+	return fmt.Errorf("no release with tag %v", tagName)
+}
+
+// publish publishes the release. s.mu must be held.
+func (s *Server) publish(r *repo, rel *github.RepositoryRelease) error {
+	h, err := s.resolve(r.owner, r.name, rel.GetTargetCommitish())
+	if err != nil {
+		return fmt.Errorf("failed to find release target: %v", err)
+	}
+	st := s.storage(r.owner, r.name)
+	tag := plumbing.NewHashReference(plumbing.NewTagReferenceName(rel.GetTagName()), h)
+	if err := st.SetReference(tag); err != nil {
+		return err
+	}
+	rel.Draft = github.Bool(false)
+	return nil
+}
+
+func timePtr(t time.Time) *time.Time { return &t }
@@ -0,0 +1,258 @@
+// Package fakegithub implements an in-process stand-in for the parts of the
+// github API and git hosting used by the release bot, so the whole release
+// flow can be tested without network. It's only for tests.
+//
+// The API is served by an httptest server, and the git repos are bare repos in
+// a temp dir, served to go-git with the "fakegit" protocol. Refs created with
+// the API are created in the bare repos, so the API and git agree.
+package fakegithub
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+)
+
+// GitProtocol is the URL scheme of the fake git repos.
+const GitProtocol = "fakegit"
+
+func init() {
+	// The repos are loaded by their absolute path, so all Servers can share
+	// the protocol.
+	client.InstallProtocol(GitProtocol, &gitTransport{server.NewServer(loader)})
+}
+
+// gitTransport serves the fake git protocol. Like github for private repos,
+// it rejects the requests without credentials, fetches included.
+type gitTransport struct {
+	transport.Transport
+}
+
+func (t *gitTransport) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	if err := loader.checkAuth(ep, auth); err != nil {
+		return nil, err
+	}
+	return t.Transport.NewUploadPackSession(ep, auth)
+}
+
+func (t *gitTransport) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+	if err := loader.checkAuth(ep, auth); err != nil {
+		return nil, err
+	}
+	return t.Transport.NewReceivePackSession(ep, auth)
+}
+
+// loader loads the repos of the running Servers. Paths outside of their dirs
+// are not found, so the protocol can't read the rest of the filesystem.
+var loader = &dirLoader{dirs: make(map[string]*serverDir)}
+
+type dirLoader struct {
+	mu sync.Mutex
+	// dirs are the Servers' dirs, by dir.
+	dirs map[string]*serverDir
+}
+
+// serverDir is the dir of a Server, with the loader of its repos.
+type serverDir struct {
+	s      *Server
+	loader server.Loader
+}
+
+func (l *dirLoader) add(s *Server) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dirs[filepath.ToSlash(s.dir)] = &serverDir{s: s, loader: server.NewFilesystemLoader(osfs.New(s.dir))}
+}
+
+func (l *dirLoader) remove(dir string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.dirs, filepath.ToSlash(dir))
+}
+
+// find returns the dir with the repo at ep.Path, and the path of the repo in
+// it, or nil if the repo isn't in one of the dirs.
+func (l *dirLoader) find(ep *transport.Endpoint) (*serverDir, string) {
+	p := path.Clean(ep.Path)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for dir, sd := range l.dirs {
+		if rel := strings.TrimPrefix(p, dir+"/"); rel != p {
+			return sd, rel
+		}
+	}
+	return nil, ""
+}
+
+// Load loads the repo at ep.Path, if it's in one of the dirs.
+func (l *dirLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	sd, rel := l.find(ep)
+	if sd == nil {
+		return nil, transport.ErrRepositoryNotFound
+	}
+	return sd.loader.Load(&transport.Endpoint{Path: rel})
+}
+
+// checkAuth checks auth is a username and a token, accepted by the Server of
+// the repo at ep.Path.
+func (l *dirLoader) checkAuth(ep *transport.Endpoint, auth transport.AuthMethod) error {
+	a, ok := auth.(*githttp.BasicAuth)
+	if !ok || a.Password == "" {
+		return transport.ErrAuthenticationRequired
+	}
+	sd, _ := l.find(ep)
+	if sd == nil {
+		return transport.ErrRepositoryNotFound
+	}
+	sd.s.mu.Lock()
+	defer sd.s.mu.Unlock()
+	return sd.s.checkGitToken(a.Password)
+}
+
+// Server is a fake github.
+type Server struct {
+	// URL is the base URL of the API, for ghclient.
+	URL string
+	// GitURL is the base URL of the git repos, for gitwrapper. The repo
+	// owner/repo is at GitURL/owner/repo.
+	GitURL string
+
+	// AutoMerge, if true, marks new PRs as merged right away. The branches
+	// are not merged in git.
+	AutoMerge bool
+	// AutoPublish, if true, publishes new draft releases right away, and
+	// creates their tags.
+	AutoPublish bool
+	// AppTokenLifetime is how long the app's installation tokens are valid.
+	// If 0, they are valid for an hour, like github's.
+	AppTokenLifetime time.Duration
+
+	ts  *httptest.Server
+	dir string
+
+	mu sync.Mutex
+	// injected are the errors to reply to the next GET requests with.
+	injected   []injectedError
+	user       *github.User
+	emails     []*github.UserEmail
+	orgMembers map[string][]string
+	repos      map[string]*repo
+	app        *app
+}
+
+// repo contains the API data of a repo. The git data is in the bare repo.
+type repo struct {
+	owner, name string
+
+	milestones []*github.Milestone
+	// issues contains both issues and PRs, like github.
+	issues []*github.Issue
+	events map[int][]*github.IssueEvent
+	pulls  map[int]*github.PullRequest
+	// nextNumber is the next issue or PR number.
+	nextNumber int
+
+	releases []*github.RepositoryRelease
+}
+
+// New starts a new fake github. Close must be called to stop it and delete the
+// repos.
+func New() (*Server, error) {
+	dir, err := ioutil.TempDir("", "fakegithub")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		dir:        dir,
+		GitURL:     GitProtocol + "://" + filepath.ToSlash(dir),
+		orgMembers: make(map[string][]string),
+		repos:      make(map[string]*repo),
+	}
+	s.ts = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.ts.URL + "/"
+	loader.add(s)
+	return s, nil
+}
+
+// Close stops the server and deletes the repos.
+func (s *Server) Close() {
+	s.ts.Close()
+	loader.remove(s.dir)
+	os.RemoveAll(s.dir)
+}
+
+// injectedError is an error reply added by InjectErrors.
+type injectedError struct {
+	code       int
+	retryAfter int
+}
+
+// InjectErrors makes the next n GET requests fail with the status code. If
+// code is 403, the errors are abuse rate limit errors, with Retry-After set to
+// retryAfter seconds.
+//
+// Only GET requests fail, because clients can't know whether other requests
+// were applied before failing.
+func (s *Server) InjectErrors(n, code, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.injected = append(s.injected, injectedError{code: code, retryAfter: retryAfter})
+	}
+}
+
+// SetUser sets the authenticated user, returned for any token.
+func (s *Server) SetUser(login, email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = &github.User{Login: github.String(login)}
+	s.emails = []*github.UserEmail{{Email: github.String(email), Primary: github.Bool(true)}}
+}
+
+// AddOrgMembers adds members to the org.
+func (s *Server) AddOrgMembers(org string, logins ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orgMembers[org] = append(s.orgMembers[org], logins...)
+}
+
+func (s *Server) repoPath(owner, name string) string {
+	return filepath.Join(s.dir, owner, name)
+}
+
+// getRepo returns the repo, or nil if it doesn't exist. s.mu must be held.
+func (s *Server) getRepo(owner, name string) *repo {
+	return s.repos[owner+"/"+name]
+}
+
+// mustGetRepo is like getRepo, but returns an error if the repo doesn't exist.
+func (s *Server) mustGetRepo(owner, name string) (*repo, error) {
+	r := s.getRepo(owner, name)
+	if r == nil {
+		return nil, fmt.Errorf("repo %v/%v doesn't exist", owner, name)
+	}
+	return r, nil
+}
+
+func (s *Server) htmlURL(parts ...interface{}) string {
+	ret := "https://github.com"
+	for _, p := range parts {
+		ret += fmt.Sprintf("/%v", p)
+	}
+	return ret
+}
@@ -6,8 +6,14 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/blang/semver"
+	"github.com/menghanl/release-git-bot/config"
+	"github.com/menghanl/release-git-bot/dryrun"
 	"github.com/menghanl/release-git-bot/ghclient"
 	"github.com/menghanl/release-git-bot/gitwrapper"
 	"github.com/olekukonko/tablewriter"
@@ -22,191 +28,474 @@ func init() {
 	log.SetLevel(log.WarnLevel)
 }
 
+// The flags. They are registered on the flag set of the subcommands that use
+// them, see the *Flags functions below.
 var (
-	token      = flag.String("token", "", "github token")
-	newVersion = flag.String("version", "", "the new version number, in the format of Major.Minor.Patch, e.g. 1.14.0")
-	user       = flag.String("user", "", "the github user. Changes will be made to this user's fork. If not specified, will be github username for the given token")
-	repo       = flag.String("repo", "grpc-go", "the repo this release is for, e.g. grpc-go")
+	token      = new(string)
+	newVersion = new(string)
 
-	email = flag.String("email", "", "the email address for the commit author. If not specified, will be github primary email for the given token")
+	// For github app auth, instead of -token.
+	appID             = new(int64)
+	appInstallationID = new(int64)
+	appKeyFile        = new(string)
 
-	// For specials thanks note.
-	thanks    = flag.Bool("thanks", true, "whether to include thank you note. grpc organization members are excluded")
-	urwelcome = flag.String("urwelcome", "", "list of users to exclude from thank you note, format: user1,user2")
-	verymuch  = flag.String("verymuch", "", "list of users to include in thank you note even if they are grpc org members, format: user1,user2")
+	user = new(string)
+	repo = new(string)
 
-	nokidding = flag.Bool("nokidding", false, "if no kidding, do real release. Eitherwise, do test in menghanl's fork")
+	email = new(string)
+
+	// For the clone of the user's fork.
+	workdir    = new(string)
+	cloneDepth = new(int)
+	syncFork   = new(bool)
+
+	// For specials thanks note, and the contributors.
+	thanks       = new(bool)
+	urwelcome    = new(string)
+	verymuch     = new(string)
+	contributors = new(bool)
+
+	nokidding   = new(bool)
+	dryRun      = new(bool)
+	yes         = new(bool)
+	concurrency = new(int)
+
+	// For the repo config.
+	configFile    = new(string)
+	upstream      = new(string)
+	baseBranch    = new(string)
+	apiURL        = new(string)
+	uploadURL     = new(string)
+	gitURL        = new(string)
+	notesTemplate = new(string)
+	notesSource   = new(string)
+	since         = new(string)
+
+	// For waiting on PRs and releases.
+	pollInterval  = new(time.Duration)
+	pollTimeout   = new(time.Duration)
+	manualConfirm = new(bool)
+
+	// For resuming an interrupted release.
+	stateFile = new(string)
+	resume    = new(bool)
 )
 
+// githubFlags are the flags needed by all subcommands.
+func githubFlags(fs *flag.FlagSet) {
+	fs.StringVar(token, "token", "", "github token")
+	fs.Int64Var(appID, "app-id", 0, "the github app ID, to authenticate as a github app installation instead of with -token")
+	fs.Int64Var(appInstallationID, "app-installation-id", 0, "the installation ID of the github app")
+	fs.StringVar(appKeyFile, "app-key", "", "the private key file (PEM) of the github app")
+	fs.StringVar(newVersion, "version", "", "the new version number, in the format of Major.Minor.Patch, e.g. 1.14.0")
+	fs.BoolVar(nokidding, "nokidding", false, "if no kidding, do real release. Eitherwise, do test in the test_upstream_user's fork from the config")
+	fs.BoolVar(dryRun, "dry-run", false, "if true, print the branches, PRs, pushes and releases that would be made instead of making them")
+	fs.BoolVar(yes, "yes", false, "if true, don't ask to confirm the inputs")
+	fs.IntVar(concurrency, "concurrency", 8, "the max number of github requests sent at the same time, lower it if github rate limits the requests")
+
+	// These flags override the config file.
+	def := config.Default()
+	fs.StringVar(configFile, "config", ".release-git-bot.yaml", "the config file for the repo. If it doesn't exist, the grpc-go config will be used")
+	fs.StringVar(repo, "repo", def.Repo, "the repo this release is for, e.g. grpc-go")
+	fs.StringVar(upstream, "upstream", def.UpstreamUser, "the owner of the upstream repo, e.g. grpc. Without -nokidding, it replaces the test_upstream_user from the config")
+	fs.StringVar(baseBranch, "base-branch", def.BaseBranch, "the branch release branches are created from")
+	fs.StringVar(apiURL, "api-url", "", "the github API URL, e.g. https://github.example.com/api/v3/ for GitHub Enterprise. If not specified, will be api_url from the config, or api.github.com")
+	fs.StringVar(uploadURL, "upload-url", "", "the github upload URL. If not specified, will be upload_url from the config, or derived from the API URL")
+	fs.StringVar(gitURL, "git-url", "", "the URL repos are cloned from and pushed to, e.g. https://github.example.com. If not specified, will be git_url from the config, or https://github.com")
+}
+
+// userFlags are the flags for the subcommands that push commits to the user's
+// fork.
+func userFlags(fs *flag.FlagSet) {
+	fs.StringVar(user, "user", "", "the github user. Changes will be made to this user's fork. If not specified, will be github username for the given token")
+	fs.StringVar(email, "email", "", "the email address for the commit author. If not specified, will be github primary email for the given token")
+	fs.StringVar(workdir, "workdir", "", "the directory to keep the clone of the fork in, at <workdir>/<user>/<repo>, and reuse in later runs. If not specified, the fork will be cloned into memory")
+	fs.IntVar(cloneDepth, "clone-depth", 0, "if not 0, only clone this many commits of the base branch")
+	fs.BoolVar(syncFork, "sync-fork", false, "if true, fast-forward the base branch of the user's fork to upstream's before cloning. The changes are based on upstream's branches either way")
+}
+
+// thanksFlags are the flags for the subcommands that generate release notes.
+func thanksFlags(fs *flag.FlagSet) {
+	fs.BoolVar(thanks, "thanks", true, "whether to include thank you note. Members of the thanks_org from the config are excluded")
+	fs.StringVar(urwelcome, "urwelcome", "", "list of users to exclude from thank you note, format: user1,user2")
+	fs.StringVar(verymuch, "verymuch", "", "list of users to include in thank you note even if they are thanks_org members, format: user1,user2")
+	fs.BoolVar(contributors, "contributors", true, "whether to end the notes with the contributors, and the new contributors with no merged PR before the previous release. Like the thank you notes, members of the thanks_org are excluded, with -urwelcome and -verymuch")
+	fs.StringVar(notesTemplate, "notes-template", "", "the text/template file for the markdown release notes. If not specified, will be notes_template from the config, or the default template")
+}
+
+// sourceFlags are the flags for the subcommands that find the PRs of a release.
+func sourceFlags(fs *flag.FlagSet) {
+	fs.StringVar(notesSource, "notes-source", "", "where to find the PRs for the release notes: milestone, or commits since the previous release, cross-checked with the milestone. If not specified, will be notes_source from the config, or milestone")
+	fs.StringVar(since, "since", "", "the tag or commit to start from when finding the PRs from commits. If not specified, the previous release tag")
+}
+
+// waitFlags are the flags for the subcommands that wait for PRs and releases.
+func waitFlags(fs *flag.FlagSet) {
+	fs.DurationVar(pollInterval, "poll-interval", 30*time.Second, "how often to check github when waiting for a PR to be merged or a release to be published")
+	fs.DurationVar(pollTimeout, "poll-timeout", 24*time.Hour, "how long to wait for a PR to be merged or a release to be published before giving up")
+	fs.BoolVar(manualConfirm, "manual-confirm", false, "if true, ask for confirmation instead of checking github when waiting for a PR to be merged or a release to be published")
+}
+
+// stateFlags are the flags for the subcommands that save progress.
+func stateFlags(fs *flag.FlagSet) {
+	fs.StringVar(stateFile, "state", ".release-git-bot-state.json", "the file to save the release progress to")
+	fs.BoolVar(resume, "resume", false, "resume the release saved in the state file, starting from the first step that hasn't finished")
+}
+
+// upstreamRemote is the name of the upstream repo's remote in the clone of the
+// fork.
+const upstreamRemote = "upstream"
+
 var (
-	upstreamUser = "menghanl" // TODO: change this back to "grpc" by default.
+	// cfg is the repo config, loaded from -config, with the flags applied.
+	cfg *config.Config
+	// upstreamUser is the owner of the upstream repo, depending on -nokidding.
+	upstreamUser string
+
+	// recorder records the mutations in dry run. It's nil if not dry run.
+	recorder *dryrun.Recorder
 )
 
+// command is a subcommand of the binary.
+type command struct {
+	name  string
+	usage string
+	// flags register the flags used by this command.
+	flags []func(fs *flag.FlagSet)
+	run   func(ctx context.Context) error
+}
+
+var commands = []*command{
+	{
+		name:  "release",
+		usage: "run the whole release, steps 1 to 5. This is the default if no command is given",
+		flags: []func(*flag.FlagSet){githubFlags, userFlags, sourceFlags, thanksFlags, waitFlags, stateFlags, prereleaseFlags},
+		run:   runRelease,
+	},
+	{
+		name:  "notes",
+		usage: "generate the release notes and print them",
+		flags: []func(*flag.FlagSet){githubFlags, sourceFlags, thanksFlags, notesFlags},
+		run:   runNotes,
+	},
+	{
+		name:  "notes audit",
+		usage: "check the merged PRs of the release for missing or conflicting labels, missing milestones and malformed release notes. Exits non-zero if any is found",
+		flags: []func(*flag.FlagSet){githubFlags, sourceFlags},
+		run:   runNotesAudit,
+	},
+	{
+		name:  "branch",
+		usage: "create the upstream release branch vMajor.Minor.x (step 1)",
+		flags: []func(*flag.FlagSet){githubFlags},
+		run:   runBranch,
+	},
+	{
+		name:  "bump",
+		usage: "send a PR to change the version on an upstream branch (step 2)",
+		flags: []func(*flag.FlagSet){githubFlags, userFlags, bumpFlags},
+		run:   runBump,
+	},
+	{
+		name:  "draft",
+		usage: "generate the release notes and create the draft release (step 3)",
+		flags: []func(*flag.FlagSet){githubFlags, sourceFlags, thanksFlags},
+		run:   runDraft,
+	},
+	{
+		name:  "backport",
+		usage: "cherry-pick the merged PRs with the backport label to the release branch, and send PRs",
+		flags: []func(*flag.FlagSet){githubFlags, userFlags, backportFlags},
+		run:   runBackport,
+	},
+	{
+		name:  "post-release",
+		usage: "send the PRs to change the version to -dev on the release branch and master (steps 4 and 5)",
+		flags: []func(*flag.FlagSet){githubFlags, userFlags},
+		run:   runPostRelease,
+	},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %v [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-13v %v\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%v <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+// findCommand returns the command with the name, or nil if there's none.
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
 func main() {
-	flag.Parse()
+	args := os.Args[1:]
+	// Without a command, run the whole release, so the old command lines keep
+	// working.
+	cmdName := "release"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmdName, args = args[0], args[1:]
+	}
+
+	if cmdName == "help" {
+		usage()
+		return
+	}
 
+	// Some commands have two words, e.g. "notes audit".
+	if len(args) > 0 && findCommand(cmdName+" "+args[0]) != nil {
+		cmdName, args = cmdName+" "+args[0], args[1:]
+	}
+	cmd := findCommand(cmdName)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", cmdName)
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	for _, f := range cmd.flags {
+		f(fs)
+	}
+	fs.Parse(args)
+
+	var err error
+	if cfg, err = loadConfig(fs); err != nil {
+		log.Fatalf("%v", err)
+	}
+	upstreamUser = cfg.TestUpstreamUser
 	if *nokidding {
-		upstreamUser = "grpc"
+		upstreamUser = cfg.UpstreamUser
+	}
+	if *dryRun {
+		recorder = dryrun.New()
+	}
+
+	if err := initAuth(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// Cancel the github requests and waits on ctrl-c.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		<-interrupted
+		cancel()
+	}()
+
+	if err := cmd.run(ctx); err != nil {
+		log.Fatalf("%v", err)
 	}
 
-	ver, err := semver.Make(*newVersion)
+	if recorder != nil && len(recorder.Mutations()) > 0 {
+		fmt.Println()
+		recorder.Print(os.Stdout)
+	}
+}
+
+// loadConfig loads the config file, and overrides it with the flags that are
+// set.
+func loadConfig(fs *flag.FlagSet) (*config.Config, error) {
+	if fs.Lookup("config") == nil {
+		return config.Default(), nil
+	}
+	c, err := config.LoadOrDefault(*configFile)
 	if err != nil {
-		log.Fatalf("invalid version string %q: %v", *newVersion, err)
+		return nil, err
 	}
-	log.Info("version is valid: ", ver.String())
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "repo":
+			c.Repo = *repo
+		case "upstream":
+			// Only the upstream picked by -nokidding is replaced, so
+			// -upstream without -nokidding still releases in a test
+			// upstream.
+			if *nokidding {
+				c.UpstreamUser = *upstream
+			} else {
+				c.TestUpstreamUser = *upstream
+			}
+		case "base-branch":
+			c.BaseBranch = *baseBranch
+		case "api-url":
+			c.APIURL = *apiURL
+		case "upload-url":
+			c.UploadURL = *uploadURL
+		case "git-url":
+			c.GitURL = *gitURL
+		case "notes-template":
+			c.NotesTemplate = *notesTemplate
+		case "notes-source":
+			c.NotesSource = *notesSource
+		}
+	})
+	*repo = c.Repo
+	return c, nil
+}
 
+// newUpstreamClient creates the github client for the upstream repo, with the
+// token from the -token flag.
+func newUpstreamClient() (*ghclient.Client, error) {
 	var transportClient *http.Client
-	if *token != "" {
-		ctx := context.Background()
-		ts := oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: *token},
-		)
-		transportClient = oauth2.NewClient(ctx, ts)
-	}
-	upstreamGithub := ghclient.New(transportClient, upstreamUser, *repo)
-	emailAddress := *email
-	if emailAddress == "" {
-		emailAddress, err = upstreamGithub.GetPrimaryEmail()
-		if err != nil {
-			log.Fatalf("Email was not specified, and failed to get primary email address from github: %v. Does your token have permission to read email?", err)
-		}
+	if tokenSource != nil {
+		transportClient = oauth2.NewClient(context.Background(), tokenSource)
 	}
-	userLogin := *user
-	if userLogin == "" {
-		userLogin, err = upstreamGithub.GetLogin()
-		if err != nil {
-			log.Fatalf("User was not specified, and failed to get login from github: %v. Does your token have permission to read user?", err)
-		}
+	return ghclient.NewWithConfig(&ghclient.Config{
+		HTTPClient:  transportClient,
+		Owner:       upstreamUser,
+		Repo:        *repo,
+		BaseBranch:  cfg.BaseBranch,
+		BaseURL:     cfg.APIURL,
+		UploadURL:   cfg.UploadURL,
+		Concurrency: *concurrency,
+		DryRun:      recorder,
+	})
+}
+
+// newReleaser creates a releaser with the given state, after the user confirms
+// the inputs.
+//
+// If withLocal is true, the user's fork is cloned, and the user and email are
+// filled in, so the releaser can make PRs.
+func newReleaser(ctx context.Context, state *releaseState, withLocal bool) (*releaser, error) {
+	ver, err := semver.Make(state.Version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version string %q: %v", state.Version, err)
+	}
+	log.Info("version is valid: ", ver.String())
+
+	upstream, err := newUpstreamClient()
+	if err != nil {
+		return nil, err
+	}
+	r := &releaser{
+		upstream: upstream,
+		ver:      ver,
+		state:    state,
+	}
+	if state.ReleaseBranch == "" {
+		state.ReleaseBranch = releaseBranchName(ver)
 	}
 
 	inputTable := tablewriter.NewWriter(os.Stdout)
 	inputTable.SetHeader([]string{"input"})
-	inputTable.Append([]string{"user", userLogin})
-	inputTable.Append([]string{"email", emailAddress})
+	if withLocal && app != nil {
+		// Apps can't have forks, so the changes are pushed to upstream
+		// directly, and committed as the app's bot user.
+		r.login = *user
+		if r.login == "" {
+			r.login = upstreamUser
+		}
+		r.name, r.email, err = app.BotIdentity(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if *email != "" {
+			r.email = *email
+		}
+		inputTable.Append([]string{"push to", r.login})
+		inputTable.Append([]string{"author", fmt.Sprintf("%v <%v>", r.name, r.email)})
+	} else if withLocal {
+		r.email = *email
+		if r.email == "" {
+			r.email, err = r.upstream.GetPrimaryEmail(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("email was not specified, and failed to get primary email address from github: %v. Does your token have permission to read email?", err)
+			}
+		}
+		r.login = *user
+		if r.login == "" {
+			r.login, err = r.upstream.GetLogin(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("user was not specified, and failed to get login from github: %v. Does your token have permission to read user?", err)
+			}
+		}
+		r.name = r.login
+		inputTable.Append([]string{"user", r.login})
+		inputTable.Append([]string{"email", r.email})
+	}
 	inputTable.Append([]string{"repo", *repo})
-	inputTable.Append([]string{"version", *newVersion})
+	inputTable.Append([]string{"version", state.Version})
 	inputTable.Append([]string{"upstreamRepo", upstreamUser + "/" + *repo})
-	inputTable.Render()
-
-	lgty := false
-	survey.AskOne(&survey.Confirm{Message: "Looks right?"}, &lgty, nil)
-	if !lgty {
-		fmt.Println("Exiting")
-		return
+	if cfg.APIURL != "" {
+		inputTable.Append([]string{"api", cfg.APIURL})
+	}
+	if cfg.GitURL != "" {
+		inputTable.Append([]string{"git", cfg.GitURL})
+	}
+	if recorder != nil {
+		inputTable.Append([]string{"dry run", "true"})
+	}
+	if state.path != "" {
+		inputTable.Append([]string{"state", state.path})
+	}
+	if len(state.CompletedSteps) > 0 {
+		inputTable.Append([]string{"completed", strings.Join(state.CompletedSteps, ",")})
 	}
+	inputTable.Render()
 
-	fmt.Printf(" - Cloning %v/%v into memory\n\n", userLogin, *repo)
-	forkLocalGit, err := gitwrapper.GithubClone(&gitwrapper.GithubCloneConfig{
-		Owner: userLogin,
-		Repo:  *repo,
-	})
-	if err != nil {
-		log.Fatalf("failed to github clone: %v", err)
-	}
-
-	fmt.Println()
-	/* Step 1: create an upstream release branch if it doesn't exist */
-	upstreamReleaseBranchName := fmt.Sprintf("v%v.%v.x", ver.Major, ver.Minor)
-	fmt.Printf(" - Step 1: create an upstream release branch %v/%v/%v\n\n", upstreamUser, *repo, upstreamReleaseBranchName)
-	upstreamGithub.NewBranchFromHead(upstreamReleaseBranchName)
-
-	fmt.Println()
-	/* Step 2: on release branch, change version file to 1.release.0 */
-	fmt.Printf(" - Step 2: on release branch, change version to %v\n\n", *newVersion)
-	prURL1 := makePR(upstreamGithub, forkLocalGit, *newVersion, upstreamReleaseBranchName, userLogin, userLogin, emailAddress)
-	// prURL1 := "https://github.com/menghanl/grpc-go/pull/17"
-	fmt.Printf("PR %v created, merge before continuing...\n", prURL1)
-
-	/* Wait for the PR to be merged */
-	prMergeConfirmed := false
-	for !prMergeConfirmed {
-		prompt := &survey.Confirm{
-			Message: "Merged?",
+	if !*yes {
+		lgty := false
+		survey.AskOne(&survey.Confirm{Message: "Looks right?"}, &lgty, nil)
+		if !lgty {
+			fmt.Println("Exiting")
+			os.Exit(0)
 		}
-		survey.AskOne(prompt, &prMergeConfirmed, nil)
 	}
 
-	fmt.Println()
-	/* Step 3: generate release note and create draft release */
-	fmt.Printf(" - Step 3: generate release note and create draft release\n\n")
-	// Get and print the markdown release notes.
-	markdownNote := releaseNote(upstreamGithub, ver)
-	// fmt.Println(markdownNote)
-
-	releaseTitle := fmt.Sprintf("Release %v", *newVersion)
-	releaseURL, err := upstreamGithub.NewDraftRelease("v"+*newVersion, upstreamReleaseBranchName, releaseTitle, markdownNote)
-	if err != nil {
-		log.Fatal("failed to create release: ", err)
+	if withLocal && *syncFork && app == nil {
+		fmt.Printf(" - Fast-forwarding %v/%v/%v to %v/%v/%v\n\n", r.login, *repo, cfg.BaseBranch, upstreamUser, *repo, cfg.BaseBranch)
+		if err := r.upstream.SyncFork(ctx, r.login, cfg.BaseBranch); err != nil {
+			return nil, err
+		}
 	}
-	// releaseURL := "https://github.com/menghanl/grpc-go/release/untaged-blahblahblah"
-	fmt.Printf("Draft release %v created, publish before continuing\n", releaseURL)
 
-	/* Wait for the release to be published */
-	releasePublishConfirmed := false
-	for !releasePublishConfirmed {
-		prompt := &survey.Confirm{
-			Message: "Published?",
+	if withLocal {
+		var dir string
+		if *workdir != "" {
+			dir = filepath.Join(*workdir, r.login, *repo)
+			fmt.Printf(" - Cloning or updating %v/%v in %v\n\n", r.login, *repo, dir)
+		} else {
+			fmt.Printf(" - Cloning %v/%v into memory\n\n", r.login, *repo)
+		}
+		r.local, err = gitwrapper.GithubClone(&gitwrapper.GithubCloneConfig{
+			Owner:   r.login,
+			Repo:    *repo,
+			Branch:  cfg.BaseBranch,
+			BaseURL: cfg.GitURL,
+			Dir:     dir,
+			Depth:   *cloneDepth,
+			Auth:    gitAuth(r.login),
+			DryRun:  recorder,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to github clone: %v", err)
+		}
+		// The changes are based on upstream's branches, the fork's may be
+		// behind.
+		if err := r.local.AddRemote(&gitwrapper.RemoteConfig{
+			Name:  upstreamRemote,
+			Owner: upstreamUser,
+			Repo:  *repo,
+		}); err != nil {
+			r.close()
+			return nil, err
 		}
-		survey.AskOne(prompt, &releasePublishConfirmed, nil)
-	}
-
-	fmt.Println()
-	/* Step 4: on release branch, change version file to 1.release.1-dev */
-	nextMinorRelease := ver
-	nextMinorRelease.Patch++ // Increment the pateh version, not the minor version.
-	nextMinorReleaseStr := fmt.Sprintf("%v-dev", nextMinorRelease.String())
-	fmt.Printf(" - Step 4: on release branch, change version to %v\n\n", nextMinorReleaseStr)
-	// prURL2 := "https://github.com/menghanl/grpc-go/pull/18"
-	prURL2 := makePR(upstreamGithub, forkLocalGit, nextMinorReleaseStr, upstreamReleaseBranchName, userLogin, userLogin, emailAddress)
-	fmt.Println("PR to merge: ", prURL2)
-
-	fmt.Println()
-	/* Step 5: on master branch, change version file to 1.release+1.0-dev */
-	nextMajorRelease := ver
-	nextMajorRelease.Minor++ // Increment the minor version, not the major version.
-	nextMajorReleaseStr := fmt.Sprintf("%v-dev", nextMajorRelease.String())
-	fmt.Printf(" - Step 5: on master branch, change version to %v\n\n", nextMajorReleaseStr)
-	// prURL3 := "https://github.com/menghanl/grpc-go/pull/19"
-	prURL3 := makePR(upstreamGithub, forkLocalGit, nextMajorReleaseStr, "master", userLogin, userLogin, emailAddress)
-	fmt.Println("PR to merge: ", prURL3)
-
-	/* Step 6: finish steps as in g3doc */
-	fmt.Println()
-	fmt.Println("Not done yet. Send the emails and add compatibility test.")
-}
-
-// return value is pr URL.
-func makePR(upstream *ghclient.Client, local *gitwrapper.Repo, newVersionStr, upstreamBranchName string, login, name, email string) string {
-	/* Step 1: make version change locally and push to fork */
-	branchName := fmt.Sprintf("release_version_%v", newVersionStr)
-	if err := local.MakeVersionChange(&gitwrapper.VersionChangeConfig{
-		VersionFile: "version.go",
-		NewVersion:  newVersionStr,
-		BranchName:  branchName,
-		UserName:    name,
-		UserEmail:   email,
-		SkipCI:      upstreamBranchName != "master", // Not skip if upstreamBranchName is "master"
-	}); err != nil {
-		log.Fatalf("failed to make change: %v", err)
-	}
-
-	if err := local.Publish(&gitwrapper.PublicConfig{
-		// This could push to upstream directly, but to be safe, we send pull
-		// request instead.
-		RemoteName: "",
-		Auth: &gitwrapper.AuthConfig{
-			Username: login,
-			Password: *token,
-		},
-	}); err != nil {
-		log.Fatalf("failed to public change: %v", err)
-	}
-
-	/* Step 2: send pull request to upstream/release_branch with the change */
-	prTitle := fmt.Sprintf("Change version to %v", newVersionStr)
-	prURL, err := upstream.NewPullRequest(login, branchName, upstreamBranchName, prTitle, "")
-	if err != nil {
-		log.Fatalf("failed to create pull request: %v", err)
 	}
-	return prURL
+	return r, nil
+}
+
+// releaseBranchName returns the name of the release branch for ver, e.g.
+// v1.14.x.
+func releaseBranchName(ver semver.Version) string {
+	return fmt.Sprintf("v%v.%v.x", ver.Major, ver.Minor)
 }
@@ -0,0 +1,124 @@
+package notes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// Finding is a PR found by Audit, with the reason.
+type Finding struct {
+	PR     *github.Issue
+	Reason string
+}
+
+// AuditResult is the result of Audit.
+type AuditResult struct {
+	// Problems are the PRs that may be in the wrong section, or missing from
+	// the notes, or have a wrong entry. They should be fixed before the
+	// release.
+	Problems []*Finding
+	// Omitted are the PRs left out of the notes on purpose, by their labels
+	// or release notes. They are not problems, but are worth a look.
+	Omitted []*Finding
+}
+
+// releaseNotesMarkerRegex matches the lines that look like a release notes
+// marker, e.g. "Release note - ...", to find the ones that don't match
+// releaseNotesRegex. Prose lines like "Release notes are ..." don't match.
+var releaseNotesMarkerRegex = regexp.MustCompile(`(?im)^\W*release[ _-]?notes?\s*[:-].*$`)
+
+// Audit checks the merged PRs for the problems that make the notes wrong:
+// missing, unknown or conflicting type labels, a missing or different
+// milestone, a malformed "RELEASE NOTES:" block, and titles used by more than
+// one PR. If milestone is empty, the milestones are not checked. If labels is
+// nil, DefaultLabelConfig is used.
+func Audit(prs []*github.Issue, milestone string, labels *LabelConfig) *AuditResult {
+	if labels == nil {
+		labels = DefaultLabelConfig()
+	}
+	ret := &AuditResult{}
+	problem := func(pr *github.Issue, format string, a ...interface{}) {
+		ret.Problems = append(ret.Problems, &Finding{PR: pr, Reason: fmt.Sprintf(format, a...)})
+	}
+	omitted := func(pr *github.Issue, format string, a ...interface{}) {
+		ret.Omitted = append(ret.Omitted, &Finding{PR: pr, Reason: fmt.Sprintf(format, a...)})
+	}
+
+	titles := make(map[string][]*github.Issue)
+	for _, pr := range prs {
+		if labels.excluded(pr) {
+			omitted(pr, "has an exclude label, one of %v", labels.Exclude)
+			continue
+		}
+		titles[pr.GetTitle()] = append(titles[pr.GetTitle()], pr)
+
+		known, unknown := labels.sectionLabels(pr.Labels)
+		label := labels.pickSectionLabel(pr.Labels)
+		name := labels.sectionName(label)
+		for _, l := range unknown {
+			problem(pr, "unknown type label %q", l)
+		}
+		switch {
+		case len(known) == 0 && name == "":
+			problem(pr, "no type label, it's left out of the notes")
+		case len(known) == 0:
+			problem(pr, "no type label, it's in %q by default", name)
+		case len(known) > 1 && name == "":
+			problem(pr, "conflicting type labels %v, it's left out of the notes", known)
+		case len(known) > 1:
+			problem(pr, "conflicting type labels %v, it's in %q", known, name)
+		case name == "":
+			omitted(pr, "labeled %q", label)
+		}
+
+		if milestone != "" {
+			if m := pr.GetMilestone(); m == nil {
+				problem(pr, "no milestone, want %q", milestone)
+			} else if m.GetTitle() != milestone {
+				problem(pr, "in milestone %q, want %q", m.GetTitle(), milestone)
+			}
+		}
+
+		if reason := releaseNotesProblem(pr.GetBody()); reason != "" {
+			problem(pr, "%v", reason)
+		} else if len(parseReleaseNotes(pr, labels)) == 0 {
+			omitted(pr, "release notes say none")
+		}
+	}
+
+	for _, pr := range prs {
+		if labels.excluded(pr) {
+			continue
+		}
+		same := titles[pr.GetTitle()]
+		if len(same) < 2 {
+			continue
+		}
+		var others []string
+		for _, o := range same {
+			if o != pr {
+				others = append(others, fmt.Sprintf("#%v", o.GetNumber()))
+			}
+		}
+		problem(pr, "title %q is also used by %v", pr.GetTitle(), strings.Join(others, ", "))
+	}
+	return ret
+}
+
+// releaseNotesProblem returns what's wrong with the release notes block in the
+// PR body, or "" if it's fine, or if there's none.
+func releaseNotesProblem(body string) string {
+	if block, ok := releaseNotesBlock(body); ok {
+		if block == "" {
+			return `empty "RELEASE NOTES:" block`
+		}
+		return ""
+	}
+	if m := releaseNotesMarkerRegex.FindString(body); m != "" {
+		return fmt.Sprintf(`malformed release notes marker %q, want "RELEASE NOTES:"`, strings.TrimSpace(m))
+	}
+	return ""
+}
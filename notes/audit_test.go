@@ -0,0 +1,146 @@
+package notes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestAudit(t *testing.T) {
+	inMilestone := func(pr *github.Issue, title string) *github.Issue {
+		pr.Milestone = &github.Milestone{Title: github.String(title)}
+		return pr
+	}
+	for _, tt := range []struct {
+		name      string
+		prs       []*github.Issue
+		milestone string
+		problems  []string
+		omitted   []string
+	}{
+		{
+			name: "fine",
+			prs: []*github.Issue{
+				newPR(1, "Fix a crash", "RELEASE NOTES: Fix a crash in the balancer", "Type: Bug"),
+				newPR(2, "Add streaming", "", "Type: Feature"),
+			},
+		},
+		{
+			name: "no type label",
+			prs:  []*github.Issue{newPR(1, "Fix a crash", "")},
+			problems: []string{
+				`#1: no type label, it's in "Bug Fixes" by default`,
+			},
+		},
+		{
+			name: "unknown type label",
+			prs:  []*github.Issue{newPR(1, "Fix a crash", "", "Type: Bugfix", "Type: Bug")},
+			problems: []string{
+				`#1: unknown type label "Type: Bugfix"`,
+			},
+		},
+		{
+			name: "conflicting type labels",
+			prs:  []*github.Issue{newPR(1, "Fix a crash", "", "Type: Feature", "Type: Bug")},
+			problems: []string{
+				`#1: conflicting type labels [Feature Bug], it's in "New Features"`,
+			},
+		},
+		{
+			name: "conflicting type labels without a section",
+			prs:  []*github.Issue{newPR(1, "Add a test", "", "Type: Testing", "Type: Internal Cleanup")},
+			problems: []string{
+				`#1: conflicting type labels [Testing Internal Cleanup], it's left out of the notes`,
+			},
+		},
+		{
+			name:    "label without a section",
+			prs:     []*github.Issue{newPR(1, "Add a test", "", "Type: Testing")},
+			omitted: []string{`#1: labeled "Testing"`},
+		},
+		{
+			name:    "exclude label",
+			prs:     []*github.Issue{newPR(1, "Fix a crash", "", "no release notes")},
+			omitted: []string{`#1: has an exclude label, one of [no release notes]`},
+		},
+		{
+			name: "milestone",
+			prs: []*github.Issue{
+				inMilestone(newPR(1, "Fix a crash", "", "Type: Bug"), "1.14 Release"),
+				newPR(2, "Fix a leak", "", "Type: Bug"),
+				inMilestone(newPR(3, "Fix a race", "", "Type: Bug"), "1.13 Release"),
+			},
+			milestone: "1.14 Release",
+			problems: []string{
+				`#2: no milestone, want "1.14 Release"`,
+				`#3: in milestone "1.13 Release", want "1.14 Release"`,
+			},
+		},
+		{
+			name: "empty release notes block",
+			prs:  []*github.Issue{newPR(1, "Fix a crash", "RELEASE NOTES:\n\n## Testing", "Type: Bug")},
+			problems: []string{
+				`#1: empty "RELEASE NOTES:" block`,
+			},
+		},
+		{
+			name: "malformed release notes marker",
+			prs:  []*github.Issue{newPR(1, "Fix a crash", "Fixes #10.\n\nRelease note: Fix a crash", "Type: Bug")},
+			problems: []string{
+				`#1: malformed release notes marker "Release note: Fix a crash", want "RELEASE NOTES:"`,
+			},
+		},
+		{
+			name: "prose about release notes",
+			prs:  []*github.Issue{newPR(1, "Fix a crash", "Release notes are generated from the titles.", "Type: Bug")},
+		},
+		{
+			name:    "release notes say none",
+			prs:     []*github.Issue{newPR(1, "Fix a typo", "RELEASE NOTES: N/A", "Type: Bug")},
+			omitted: []string{`#1: release notes say none`},
+		},
+		{
+			name: "duplicate titles",
+			prs: []*github.Issue{
+				newPR(1, "Fix a crash", "", "Type: Bug"),
+				newPR(2, "Fix a crash", "", "Type: Bug"),
+			},
+			problems: []string{
+				`#1: title "Fix a crash" is also used by #2`,
+				`#2: title "Fix a crash" is also used by #1`,
+			},
+		},
+		{
+			name: "duplicate titles with an excluded PR",
+			prs: []*github.Issue{
+				newPR(1, "Fix a crash", "", "no release notes"),
+				newPR(2, "Fix a crash", "", "Type: Bug"),
+				newPR(3, "Fix a crash", "", "Type: Bug"),
+			},
+			problems: []string{
+				`#2: title "Fix a crash" is also used by #3`,
+				`#3: title "Fix a crash" is also used by #2`,
+			},
+			omitted: []string{`#1: has an exclude label, one of [no release notes]`},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Audit(tt.prs, tt.milestone, nil)
+			if got := findingStrings(res.Problems); !reflect.DeepEqual(got, tt.problems) {
+				t.Errorf("Audit() problems = %q, want %q", got, tt.problems)
+			}
+			if got := findingStrings(res.Omitted); !reflect.DeepEqual(got, tt.omitted) {
+				t.Errorf("Audit() omitted = %q, want %q", got, tt.omitted)
+			}
+		})
+	}
+}
+
+func findingStrings(fs []*Finding) []string {
+	var ret []string
+	for _, f := range fs {
+		ret = append(ret, "#"+github.Stringify(f.PR.GetNumber())+": "+f.Reason)
+	}
+	return ret
+}
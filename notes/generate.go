@@ -2,6 +2,7 @@ package notes
 
 import (
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/fatih/color"
@@ -16,10 +17,20 @@ type Filters struct {
 	// if SpecialThanks returns true, a special thanks note will be included for
 	// the author.
 	SpecialThanks func(pr *github.Issue) bool
+	// If Contributor is not nil, the notes have the Contributors, with the
+	// authors of the PRs it returns true for.
+	Contributor func(pr *github.Issue) bool
+	// If NewContributor returns true, the user is one of the new contributors.
+	NewContributor func(login string) bool
 }
 
-// GenerateNotes generate the release notes from the given prs and maps.
-func GenerateNotes(org, repo, version string, prs []*github.Issue, filters Filters) *Notes {
+// GenerateNotes generate the release notes from the given prs. The PRs are put
+// in sections by their labels, and grouped by area if labels.Areas is set, see
+// LabelConfig. If labels is nil, DefaultLabelConfig is used.
+func GenerateNotes(org, repo, version string, prs []*github.Issue, labels *LabelConfig, filters Filters) *Notes {
+	if labels == nil {
+		labels = DefaultLabelConfig()
+	}
 	notes := Notes{
 		Org:     org,
 		Repo:    repo,
@@ -32,84 +43,216 @@ func GenerateNotes(org, repo, version string, prs []*github.Issue, filters Filte
 		if filters.Ignore != nil && filters.Ignore(pr) {
 			continue
 		}
-		if shouldIgnore(pr) {
+		if labels.excluded(pr) {
 			continue
 		}
 
-		label := pickMostWeightedLabel(pr.Labels)
-		_, ok := labelToSectionName[label]
-		if !ok {
-			continue // If ok==false, ignore this PR in the release note.
-		}
+		prLabel := labels.pickSectionLabel(pr.Labels)
 		log.Infof(" [%v] - %s", color.BlueString("%v", pr.GetNumber()), *pr.Title)
-		log.Info(color.GreenString("%-18q", label))
+		log.Info(color.GreenString("%-18q", prLabel))
 		log.Infof(" from: %v\n", labelsToString(pr.Labels))
 
-		section, ok := sectionsMap[label]
-		if !ok {
-			section = &Section{Name: labelToSectionName[label], LabelName: label}
-			sectionsMap[label] = section
+		user := pr.GetUser()
+		milestone := pr.GetMilestone()
+		area := labels.area(pr)
+
+		for _, rn := range parseReleaseNotes(pr, labels) {
+			label := prLabel
+			if rn.label != "" {
+				label = rn.label
+			}
+			sectionName := labels.sectionName(label)
+			if sectionName == "" {
+				continue // Not a section in the notes, ignore this entry.
+			}
+
+			title := rn.title
+			if area != "" {
+				// The area is the subsection name, so it's not repeated in
+				// the title.
+				title = strings.TrimPrefix(title, area+": ")
+			}
 
-			notes.Sections = append(notes.Sections, section)
+			section, ok := sectionsMap[label]
+			if !ok {
+				section = &Section{Name: sectionName, LabelName: label}
+				sectionsMap[label] = section
+
+				notes.Sections = append(notes.Sections, section)
+			}
+
+			entry := &Entry{
+				// head: fmt.Sprintf("%v (#%d)", pr.GetTitle(), pr.GetNumber()),
+				IssueNumber: pr.GetNumber(),
+				Title:       title,
+				HTMLURL:     pr.GetHTMLURL(),
+				Area:        area,
+
+				User: &User{
+					AvatarURL: user.GetAvatarURL(),
+					HTMLURL:   user.GetHTMLURL(),
+					Login:     user.GetLogin(),
+				},
+
+				MileStone: &MileStone{
+					ID:    milestone.GetID(),
+					Title: milestone.GetTitle(),
+				},
+				SpecialThanks: filters.SpecialThanks != nil && filters.SpecialThanks(pr),
+			}
+			section.Entries = append(section.Entries, entry)
+		}
+	}
+	notes.Sections = labels.sortSections(notes.Sections)
+	if labels.Areas != nil {
+		for _, section := range notes.Sections {
+			section.Subsections = groupByArea(section.Entries)
 		}
+	}
+	if filters.Contributor != nil {
+		notes.Contributors = contributors(prs, filters)
+	}
+	return &notes
+}
 
+// contributors returns the authors of the PRs that pass filters.Contributor,
+// or nil if there are none.
+func contributors(prs []*github.Issue, filters Filters) *Contributors {
+	var ret Contributors
+	seen := make(map[string]bool)
+	for _, pr := range prs {
+		if filters.Ignore != nil && filters.Ignore(pr) {
+			continue
+		}
 		user := pr.GetUser()
-		milestone := pr.GetMilestone()
-
-		title, ok := getReleaseTitle(pr)
-		if !ok {
+		if user.GetLogin() == "" || seen[user.GetLogin()] || !filters.Contributor(pr) {
 			continue
 		}
-
-		entry := &Entry{
-			// head: fmt.Sprintf("%v (#%d)", pr.GetTitle(), pr.GetNumber()),
-			IssueNumber: pr.GetNumber(),
-			Title:       title,
-			HTMLURL:     pr.GetHTMLURL(),
-
-			User: &User{
-				AvatarURL: user.GetAvatarURL(),
-				HTMLURL:   user.GetHTMLURL(),
-				Login:     user.GetLogin(),
-			},
-
-			MileStone: &MileStone{
-				ID:    milestone.GetID(),
-				Title: milestone.GetTitle(),
-			},
-			SpecialThanks: filters.SpecialThanks != nil && filters.SpecialThanks(pr),
+		seen[user.GetLogin()] = true
+		u := &User{
+			AvatarURL: user.GetAvatarURL(),
+			HTMLURL:   user.GetHTMLURL(),
+			Login:     user.GetLogin(),
+		}
+		ret.All = append(ret.All, u)
+		if filters.NewContributor != nil && filters.NewContributor(u.Login) {
+			ret.New = append(ret.New, u)
 		}
-		section.Entries = append(section.Entries, entry)
 	}
-	notes.Sections = sortSections(notes.Sections)
-	return &notes
+	if len(ret.All) == 0 {
+		return nil
+	}
+	for _, users := range [][]*User{ret.All, ret.New} {
+		sort.Slice(users, func(i, j int) bool {
+			return strings.ToLower(users[i].Login) < strings.ToLower(users[j].Login)
+		})
+	}
+	return &ret
 }
 
-var releaseNotesRegex = regexp.MustCompile(`(?s)RELEASE NOTES:\s*(.*)`)
+var (
+	// releaseNotesRegex matches the release notes block of a PR body, from the
+	// marker to the end of the body.
+	releaseNotesRegex = regexp.MustCompile(`(?s)RELEASE NOTES:(.*)`)
+	// releaseNotesEndRegex matches the lines that end the release notes block
+	// before the end of the body: a markdown heading, or an HTML comment, e.g.
+	// from the PR template.
+	releaseNotesEndRegex = regexp.MustCompile(`(?m)^ {0,3}(#{1,6}(\s|$)|<!--)`)
+	// bulletRegex matches the start of a top level list item, a bullet or a
+	// number, e.g. "- ", "1. " or "2) ".
+	bulletRegex = regexp.MustCompile(`^ ?(?:[-*+]|\d+[.)])\s+`)
+	// nestedBulletRegex matches the start of an indented list item.
+	nestedBulletRegex = regexp.MustCompile(`^(?: {2,}|\t)\s*(?:[-*+]|\d+[.)])\s+`)
+	// sectionOverrideRegex matches the "[Label]" prefix of an entry that puts
+	// it in another section than the PR's, e.g. "[Behavior Change] ...".
+	sectionOverrideRegex = regexp.MustCompile(`^\[([^\]]+)\]\s*`)
+)
 
-func getReleaseTitle(pr *github.Issue) (string, bool) {
-	f := releaseNotesRegex.FindStringSubmatch(pr.GetBody())
-	if len(f) < 2 {
-		log.Info(" -- no release notes found, fallback to title")
-		return pr.GetTitle(), true
-	}
-	log.Info(" +++ ", f)
-	n := strings.TrimSpace(f[1])
-	if strings.EqualFold(n, "none") || strings.EqualFold(n, "n/a") {
-		log.Info(" -- skiping note: ", n)
+// releaseNote is an entry of the release notes of a PR.
+type releaseNote struct {
+	// label is the section label from the "[Label]" prefix, or "" for the
+	// section of the PR.
+	label string
+	title string
+}
+
+// releaseNotesBlock returns the text of the release notes block of the PR
+// body, and whether the body has one.
+func releaseNotesBlock(body string) (string, bool) {
+	f := releaseNotesRegex.FindStringSubmatch(body)
+	if f == nil {
 		return "", false
 	}
-	return strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(n, "- "), "* ")), true
+	text := f[1]
+	if loc := releaseNotesEndRegex.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	return strings.TrimSpace(text), true
 }
 
-const noReleaseNotesLabel = "no release notes"
+// parseReleaseNotes returns the entries of the release notes of the PR.
+//
+// If the body has a non-empty release notes block, each top level list item of
+// the block, bulleted or numbered, is an entry, or the whole block is one entry
+// if it's not a list. The lines of an item are joined into one line. Nested
+// items are details for the reviewers, they are dropped with their lines until
+// the next top level item. An entry can start with "[Label]", where Label is a
+// section label, to be in that section instead of the PR's. The entries that
+// are "none" or "n/a" are dropped. Without a block, the PR title is the only
+// entry.
+func parseReleaseNotes(pr *github.Issue, labels *LabelConfig) []*releaseNote {
+	block, ok := releaseNotesBlock(pr.GetBody())
+	if !ok || block == "" {
+		log.Info(" -- no release notes found, fallback to title")
+		return []*releaseNote{{title: pr.GetTitle()}}
+	}
+	log.Info(" +++ ", block)
+
+	var (
+		texts  []string
+		cur    []string
+		nested bool
+	)
+	flush := func() {
+		if len(cur) > 0 {
+			texts = append(texts, strings.Join(cur, " "))
+			cur = nil
+		}
+	}
+	for _, line := range strings.Split(block, "\n") {
+		if loc := bulletRegex.FindStringIndex(line); loc != nil {
+			flush()
+			line = line[loc[1]:]
+			nested = false
+		} else if nestedBulletRegex.MatchString(line) {
+			nested = true
+		}
+		if nested {
+			if line = strings.TrimSpace(line); line != "" {
+				log.Info(" -- dropping nested item line: ", line)
+			}
+			continue
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			cur = append(cur, line)
+		}
+	}
+	flush()
 
-// Return true if labels contain "no release notes".
-func shouldIgnore(pr *github.Issue) bool {
-	for _, l := range pr.Labels {
-		if l.GetName() == noReleaseNotesLabel {
-			return true
+	var ret []*releaseNote
+	for _, text := range texts {
+		if strings.EqualFold(text, "none") || strings.EqualFold(text, "n/a") {
+			log.Info(" -- skiping note: ", text)
+			continue
+		}
+		rn := &releaseNote{title: text}
+		if m := sectionOverrideRegex.FindStringSubmatch(text); m != nil {
+			if label := strings.TrimPrefix(m[1], labels.Prefix); labels.index(label) >= 0 {
+				rn.label = label
+				rn.title = text[len(m[0]):]
+			}
 		}
+		ret = append(ret, rn)
 	}
-	return false
+	return ret
 }
@@ -0,0 +1,220 @@
+package notes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func newPR(num int, title, body string, labels ...string) *github.Issue {
+	pr := &github.Issue{
+		Number:  github.Int(num),
+		Title:   github.String(title),
+		Body:    github.String(body),
+		HTMLURL: github.String("https://github.com/grpc/grpc-go/pull/" + title),
+		User:    &github.User{Login: github.String("gopher")},
+	}
+	for _, l := range labels {
+		pr.Labels = append(pr.Labels, github.Label{Name: github.String(l)})
+	}
+	return pr
+}
+
+func TestParseReleaseNotes(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		body string
+		want []*releaseNote
+	}{
+		{
+			name: "no block",
+			body: "Fixes #10.",
+			want: []*releaseNote{{title: "PR title"}},
+		},
+		{
+			name: "empty block",
+			body: "RELEASE NOTES:\n\n## Testing\n- Not a note",
+			want: []*releaseNote{{title: "PR title"}},
+		},
+		{
+			name: "one line",
+			body: "Fixes #10.\n\nRELEASE NOTES: Fix a crash",
+			want: []*releaseNote{{title: "Fix a crash"}},
+		},
+		{
+			name: "not a list",
+			body: "RELEASE NOTES:\nFix a crash in\nthe balancer",
+			want: []*releaseNote{{title: "Fix a crash in the balancer"}},
+		},
+		{
+			name: "bullets",
+			body: "RELEASE NOTES:\n- Fix a crash\n* Fix a leak\n+ Fix a race",
+			want: []*releaseNote{{title: "Fix a crash"}, {title: "Fix a leak"}, {title: "Fix a race"}},
+		},
+		{
+			name: "numbers",
+			body: "RELEASE NOTES:\n1. Fix a crash\n2) Fix a leak\n10. Fix a race",
+			want: []*releaseNote{{title: "Fix a crash"}, {title: "Fix a leak"}, {title: "Fix a race"}},
+		},
+		{
+			name: "continuation lines",
+			body: "RELEASE NOTES:\n- Fix a crash in the\n  balancer\n1. Fix a leak in\n   the transport",
+			want: []*releaseNote{{title: "Fix a crash in the balancer"}, {title: "Fix a leak in the transport"}},
+		},
+		{
+			name: "nested items",
+			body: "RELEASE NOTES:\n- Fix a crash\n  - when the balancer\n    is closed\n  1. Not a note\n\n- Fix a leak\n1. Fix a race\n\t* Not a note",
+			want: []*releaseNote{{title: "Fix a crash"}, {title: "Fix a leak"}, {title: "Fix a race"}},
+		},
+		{
+			name: "label override",
+			body: "RELEASE NOTES:\n- [Behavior Change] Close idle connections\n- [Type: Feature] Add a test server",
+			want: []*releaseNote{{label: "Behavior Change", title: "Close idle connections"}, {label: "Feature", title: "Add a test server"}},
+		},
+		{
+			name: "unknown label override",
+			body: "RELEASE NOTES: [xds] Support RBAC",
+			want: []*releaseNote{{title: "[xds] Support RBAC"}},
+		},
+		{
+			name: "ends at heading",
+			body: "RELEASE NOTES:\n- Fix a crash\n\n### Testing\n- Not a note",
+			want: []*releaseNote{{title: "Fix a crash"}},
+		},
+		{
+			name: "ends at HTML comment",
+			body: "RELEASE NOTES:\n- Fix a crash\n<!-- Not a note -->\n- Still not a note",
+			want: []*releaseNote{{title: "Fix a crash"}},
+		},
+		{
+			name: "none",
+			body: "RELEASE NOTES: none",
+		},
+		{
+			name: "n/a",
+			body: "RELEASE NOTES: N/A",
+		},
+		{
+			name: "none entry",
+			body: "RELEASE NOTES:\n- Fix a crash\n- none",
+			want: []*releaseNote{{title: "Fix a crash"}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseReleaseNotes(newPR(1, "PR title", tt.body), DefaultLabelConfig())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseReleaseNotes(%q) = %v, want %v", tt.body, notesString(got), notesString(tt.want))
+			}
+		})
+	}
+}
+
+func notesString(rns []*releaseNote) []releaseNote {
+	var ret []releaseNote
+	for _, rn := range rns {
+		ret = append(ret, *rn)
+	}
+	return ret
+}
+
+func TestGenerateNotes(t *testing.T) {
+	areas := DefaultLabelConfig()
+	areas.Areas = &AreaConfig{LabelPrefix: "Area: ", FromTitle: true}
+
+	for _, tt := range []struct {
+		name    string
+		prs     []*github.Issue
+		labels  *LabelConfig
+		filters Filters
+		want    string
+	}{
+		{
+			name: "sections",
+			prs: []*github.Issue{
+				newPR(1, "Fix a crash", "", "Type: Bug"),
+				newPR(2, "Add streaming", "", "Type: Feature"),
+				newPR(3, "Clean up", "", "Type: Internal Cleanup"),
+				newPR(4, "Not for the notes", "", "Type: Feature", "no release notes"),
+				newPR(5, "Fix a leak", ""),
+			},
+			want: "# New Features\n\n * Add streaming (#2)\n\n" +
+				"# Bug Fixes\n\n * Fix a crash (#1)\n * Fix a leak (#5)\n\n",
+		},
+		{
+			name: "release notes blocks",
+			prs: []*github.Issue{
+				newPR(1, "Fix the balancer", "RELEASE NOTES:\n- Fix a crash\n- [Behavior Change] Close idle connections", "Type: Bug"),
+				newPR(2, "Add a test server", "RELEASE NOTES: [Feature] Add a test server", "Type: Testing"),
+				newPR(3, "Fix a typo", "RELEASE NOTES: none", "Type: Bug"),
+			},
+			want: "# Behavior Changes\n\n * Close idle connections (#1)\n\n" +
+				"# New Features\n\n * Add a test server (#2)\n\n" +
+				"# Bug Fixes\n\n * Fix a crash (#1)\n\n",
+		},
+		{
+			name: "areas",
+			prs: []*github.Issue{
+				newPR(1, "xds: Fix a crash", "", "Type: Bug"),
+				newPR(2, "Fix a leak", "", "Type: Bug", "Area: transport"),
+				newPR(3, "Fix a typo", "", "Type: Bug"),
+				newPR(4, "xds/rbac: Fix a panic", "", "Type: Bug"),
+				newPR(5, "Add streaming", "", "Type: Feature"),
+			},
+			labels: areas,
+			want: "# New Features\n\n * Add streaming (#5)\n\n" +
+				"# Bug Fixes\n\n * Fix a typo (#3)\n * transport\n   * Fix a leak (#2)\n * xds\n   * Fix a crash (#1)\n * xds/rbac\n   * Fix a panic (#4)\n\n",
+		},
+		{
+			name: "special thanks",
+			prs: []*github.Issue{
+				newPR(1, "Fix a crash", "", "Type: Bug"),
+				newPR(2, "Fix a leak", "", "Type: Bug"),
+			},
+			filters: Filters{SpecialThanks: func(pr *github.Issue) bool { return pr.GetNumber() == 2 }},
+			want:    "# Bug Fixes\n\n * Fix a crash (#1)\n * Fix a leak (#2)\n   - Special Thanks: @gopher\n\n",
+		},
+		{
+			name: "contributors",
+			prs: func() []*github.Issue {
+				prs := []*github.Issue{
+					newPR(1, "Fix a crash", "", "Type: Bug"),
+					newPR(2, "Fix a leak", "", "Type: Bug"),
+					newPR(3, "Fix a race", "", "Type: Bug"),
+					newPR(4, "Add a test", "", "Type: Testing"),
+				}
+				prs[1].User.Login = github.String("Newcomer")
+				prs[2].User.Login = github.String("member")
+				prs[3].User.Login = github.String("alice")
+				return prs
+			}(),
+			filters: Filters{
+				Contributor:    func(pr *github.Issue) bool { return pr.GetUser().GetLogin() != "member" },
+				NewContributor: func(login string) bool { return login == "Newcomer" },
+			},
+			want: "# Bug Fixes\n\n * Fix a crash (#1)\n * Fix a leak (#2)\n * Fix a race (#3)\n\n" +
+				"# Contributors\n\nThanks to everyone who contributed to this release: @alice, @gopher, @Newcomer\n\n" +
+				"Welcome to the new contributors: @Newcomer\n\n",
+		},
+		{
+			name: "ignored",
+			prs: []*github.Issue{
+				newPR(1, "Fix a crash", "", "Type: Bug"),
+				newPR(2, "Fix a leak", "", "Type: Bug"),
+			},
+			filters: Filters{
+				Ignore:      func(pr *github.Issue) bool { return pr.GetNumber() == 2 },
+				Contributor: func(pr *github.Issue) bool { return true },
+			},
+			want: "# Bug Fixes\n\n * Fix a crash (#1)\n\n" +
+				"# Contributors\n\nThanks to everyone who contributed to this release: @gopher\n\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GenerateNotes("grpc", "grpc-go", "1.0.0", tt.prs, tt.labels, tt.filters).ToMarkdown()
+			if got != tt.want {
+				t.Errorf("GenerateNotes() notes:\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package notes
 
 import (
+	"regexp"
 	"sort"
 	"strings"
 
@@ -8,65 +9,192 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-const (
-	labelPrefix  = "Type: "
-	defaultLabel = "Bug"
-)
+// LabelConfig maps the labels of the PRs to the sections of the notes.
+type LabelConfig struct {
+	// Prefix is trimmed from the labels before they are matched with the
+	// section labels, e.g. "Type: ".
+	Prefix string
+	// Sections are the section labels, most important first. A PR with more
+	// than one section label is in the first section, and the sections are in
+	// this order in the notes.
+	Sections []*SectionLabel
+	// Default is the section label of the PRs without any of the section
+	// labels.
+	Default string
+	// Exclude are the labels, without trimming Prefix, that exclude a PR from
+	// the notes, e.g. "no release notes".
+	Exclude []string
+	// Areas, if not nil, groups the entries of each section in subsections by
+	// area.
+	Areas *AreaConfig
+}
 
-var sortWeight = map[string]int{
-	"Dependencies":     70,
-	"API Change":       60,
-	"Behavior Change":  50,
-	"Feature":          40,
-	"Performance":      30,
-	"Bug":              20,
-	"Documentation":    10,
-	"Testing":          0,
-	"Internal Cleanup": 0,
+// AreaConfig is how the areas of the PRs are found, to group the entries of
+// the sections by area.
+type AreaConfig struct {
+	// LabelPrefix is the prefix of the area labels, e.g. "Area: ". The area of
+	// a PR is its first label with the prefix, without the prefix.
+	LabelPrefix string
+	// FromTitle, if true, takes the area of the PRs without an area label
+	// from the package prefix of the title, e.g. "xds" for "xds: fix a crash".
+	FromTitle bool
 }
 
-func sortLabelName(labels []string) []string {
-	sort.Slice(labels, func(i, j int) bool {
-		return sortWeight[labels[i]] >= sortWeight[labels[j]]
-	})
-	return labels
+// titleAreaRegex matches the package prefix of a PR title, e.g. "xds: " or
+// "balancer/weightedroundrobin: ".
+var titleAreaRegex = regexp.MustCompile(`^([\w./-]+):\s+`)
+
+// SectionLabel is a label that puts a PR in a section.
+type SectionLabel struct {
+	// Label is the label, without the prefix, e.g. "Feature".
+	Label string
+	// Name is the section name, e.g. "New Features". If empty, the PRs with
+	// this label are not in the notes, e.g. for "Testing".
+	Name string
+}
+
+// DefaultLabelConfig returns the labels of grpc-go.
+func DefaultLabelConfig() *LabelConfig {
+	return &LabelConfig{
+		Prefix: "Type: ",
+		Sections: []*SectionLabel{
+			{Label: "Dependencies", Name: "Dependencies"},
+			{Label: "API Change", Name: "API Changes"},
+			{Label: "Behavior Change", Name: "Behavior Changes"},
+			{Label: "Feature", Name: "New Features"},
+			{Label: "Performance", Name: "Performance Improvements"},
+			{Label: "Bug", Name: "Bug Fixes"},
+			{Label: "Documentation", Name: "Documentation"},
+			{Label: "Testing"},
+			{Label: "Internal Cleanup"},
+		},
+		Default: "Bug",
+		Exclude: []string{"no release notes"},
+	}
+}
+
+// index returns the position of the section label in c.Sections, or -1 if
+// it's not a section label.
+func (c *LabelConfig) index(label string) int {
+	for i, s := range c.Sections {
+		if s.Label == label {
+			return i
+		}
+	}
+	return -1
 }
 
-func pickMostWeightedLabel(labels []github.Label) string {
-	if len(labels) <= 0 {
-		log.Info("0 lable was assigned to issue")
-		return defaultLabel
+// sectionName returns the name of the section for the label, or "" if the PRs
+// with the label are not in the notes.
+func (c *LabelConfig) sectionName(label string) string {
+	if i := c.index(label); i >= 0 {
+		return c.Sections[i].Name
 	}
-	var names []string
+	return ""
+}
+
+// pickSectionLabel returns the first section label in c.Sections that the PR
+// has, or c.Default if it has none.
+func (c *LabelConfig) pickSectionLabel(labels []github.Label) string {
+	best := -1
 	for _, l := range labels {
-		names = append(names, strings.TrimPrefix(l.GetName(), labelPrefix))
+		i := c.index(strings.TrimPrefix(l.GetName(), c.Prefix))
+		if i >= 0 && (best < 0 || i < best) {
+			best = i
+		}
 	}
-	sortLabelName(names)
-	if _, ok := sortWeight[names[0]]; !ok {
-		return defaultLabel
+	if best < 0 {
+		log.Infof("no section label in %v, using %q", labelsToString(labels), c.Default)
+		return c.Default
 	}
-	return names[0]
+	return c.Sections[best].Label
 }
 
-var labelToSectionName = map[string]string{
-	"Dependencies":    "Dependencies",
-	"API Change":      "API Changes",
-	"Behavior Change": "Behavior Changes",
-	"Feature":         "New Features",
-	"Performance":     "Performance Improvements",
-	"Bug":             "Bug Fixes",
-	"Documentation":   "Documentation",
+// sectionLabels returns the distinct section labels of the PR, in the order
+// of c.Sections, and the labels with c.Prefix that are not section labels.
+func (c *LabelConfig) sectionLabels(labels []github.Label) (known, unknown []string) {
+	has := make(map[string]bool)
+	for _, l := range labels {
+		name := l.GetName()
+		trimmed := strings.TrimPrefix(name, c.Prefix)
+		if c.index(trimmed) >= 0 {
+			has[trimmed] = true
+		} else if c.Prefix != "" && strings.HasPrefix(name, c.Prefix) {
+			unknown = append(unknown, name)
+		}
+	}
+	for _, s := range c.Sections {
+		if has[s.Label] {
+			known = append(known, s.Label)
+		}
+	}
+	return known, unknown
 }
 
-func sortSections(sections []*Section) []*Section {
+// area returns the area of the PR, or "" if it has none or c.Areas is nil.
+func (c *LabelConfig) area(pr *github.Issue) string {
+	if c.Areas == nil {
+		return ""
+	}
+	if c.Areas.LabelPrefix != "" {
+		for _, l := range pr.Labels {
+			if strings.HasPrefix(l.GetName(), c.Areas.LabelPrefix) {
+				return strings.TrimPrefix(l.GetName(), c.Areas.LabelPrefix)
+			}
+		}
+	}
+	if c.Areas.FromTitle {
+		if m := titleAreaRegex.FindStringSubmatch(pr.GetTitle()); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// excluded returns true if the PR has one of the c.Exclude labels.
+func (c *LabelConfig) excluded(pr *github.Issue) bool {
+	for _, l := range pr.Labels {
+		for _, e := range c.Exclude {
+			if l.GetName() == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sortSections drops the empty sections, and sorts the others in the order of
+// c.Sections.
+func (c *LabelConfig) sortSections(sections []*Section) []*Section {
 	var sss []*Section
 	for _, ss := range sections {
 		if len(ss.Entries) > 0 {
 			sss = append(sss, ss)
 		}
 	}
-	sort.Slice(sss, func(i, j int) bool {
-		return sortWeight[sections[i].LabelName] >= sortWeight[sections[j].LabelName]
+	sort.SliceStable(sss, func(i, j int) bool {
+		return c.index(sss[i].LabelName) < c.index(sss[j].LabelName)
 	})
 	return sss
 }
+
+// groupByArea returns the entries grouped by area, sorted by name, or nil if
+// none of the entries has an area.
+func groupByArea(entries []*Entry) []*Subsection {
+	var ret []*Subsection
+	subsections := make(map[string]*Subsection)
+	for _, e := range entries {
+		ss, ok := subsections[e.Area]
+		if !ok {
+			ss = &Subsection{Name: e.Area}
+			subsections[e.Area] = ss
+			ret = append(ret, ss)
+		}
+		ss.Entries = append(ss.Entries, e)
+	}
+	if len(ret) == 1 && ret[0].Name == "" {
+		return nil
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
@@ -2,31 +2,22 @@
 // notes.
 package notes
 
-import "fmt"
-
 // Notes contains all the note entries for a given release.
 type Notes struct {
 	Org      string     `json:"org"`
 	Repo     string     `json:"repo"`
 	Version  string     `json:"version"`
 	Sections []*Section `json:"sections"`
+	// Contributors is nil if the contributors are not summarized, or if there
+	// are none, see Filters.Contributor.
+	Contributors *Contributors `json:"contributors,omitempty"`
 }
 
 // ToMarkdown converts Notes into a markdown string that can be used in github
-// release description.
+// release description. See MarkdownRenderer.
 func (ns *Notes) ToMarkdown() string {
-	var ret string
-	for _, section := range ns.Sections {
-		ret += fmt.Sprintf("# %v\n\n", section.Name)
-		for _, entry := range section.Entries {
-			ret += fmt.Sprintf(" * %v (#%v)\n", entry.Title, entry.IssueNumber)
-			if entry.SpecialThanks {
-				ret += fmt.Sprintf("   - Special Thanks: @%v\n", entry.User.Login)
-			}
-		}
-		ret += "\n"
-	}
-	return ret
+	s, _ := MarkdownRenderer{}.Render(ns)
+	return s
 }
 
 // Section contains one release note section, for example "Feature".
@@ -34,6 +25,17 @@ type Section struct {
 	Name      string   `json:"name"`
 	LabelName string   `json:"label_name"`
 	Entries   []*Entry `json:"entries"`
+	// Subsections are the Entries grouped by area, sorted by name. The entries
+	// without an area are in the subsection with the empty name, first. It's
+	// empty if the entries are not grouped, see AreaConfig.
+	Subsections []*Subsection `json:"subsections,omitempty"`
+}
+
+// Subsection contains the entries of a section in one area, for example
+// "xds".
+type Subsection struct {
+	Name    string   `json:"name"`
+	Entries []*Entry `json:"entries"`
 }
 
 // Entry contains the info for one entry in the release notes.
@@ -41,6 +43,9 @@ type Entry struct {
 	IssueNumber int    `json:"issue_number"`
 	Title       string `json:"title"`
 	HTMLURL     string `json:"html_url"`
+	// Area is the area of the PR, e.g. "xds", or "" if it has none or the
+	// entries are not grouped, see AreaConfig.
+	Area string `json:"area,omitempty"`
 
 	User      *User      `json:"user"`
 	MileStone *MileStone `json:"milestone"`
@@ -48,6 +53,17 @@ type Entry struct {
 	SpecialThanks bool `json:"special_thanks"`
 }
 
+// Contributors summarizes the authors of the merged PRs in the release. Both
+// lists are sorted by login.
+type Contributors struct {
+	// All are the authors of the merged PRs, including the PRs that are not
+	// in the notes.
+	All []*User `json:"all"`
+	// New are the authors in All with no merged PR in the repo before the
+	// release.
+	New []*User `json:"new"`
+}
+
 // User represents a github user.
 type User struct {
 	AvatarURL string `json:"avatar_url"`
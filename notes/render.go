@@ -0,0 +1,209 @@
+package notes
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+)
+
+// Renderer renders Notes in a format, e.g. markdown for the github release, or
+// HTML for a web page.
+type Renderer interface {
+	Render(ns *Notes) (string, error)
+}
+
+// Renderers are the built-in renderers, keyed by the format name.
+var Renderers = map[string]Renderer{
+	"markdown": MarkdownRenderer{},
+	"html":     HTMLRenderer{},
+	"json":     JSONRenderer{},
+	"text":     TextRenderer{},
+	"slack":    SlackRenderer{},
+}
+
+// RendererForFormat returns the built-in renderer for the format name.
+func RendererForFormat(format string) (Renderer, error) {
+	r, ok := Renderers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown release notes format %q, want one of %v", format, strings.Join(Formats(), ", "))
+	}
+	return r, nil
+}
+
+// Formats returns the names of the built-in renderers, sorted.
+func Formats() []string {
+	var ret []string
+	for f := range Renderers {
+		ret = append(ret, f)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// The sentences of the contributors section, in all the formats.
+const (
+	thanksContributors  = "Thanks to everyone who contributed to this release: "
+	welcomeContributors = "Welcome to the new contributors: "
+)
+
+// joinUsers returns the users formatted by format, joined with ", ".
+func joinUsers(users []*User, format func(*User) string) string {
+	var ss []string
+	for _, u := range users {
+		ss = append(ss, format(u))
+	}
+	return strings.Join(ss, ", ")
+}
+
+// MarkdownRenderer renders the notes in github flavored markdown, for the
+// github release description, with DefaultTemplate.
+type MarkdownRenderer struct{}
+
+// Render implements Renderer.
+func (MarkdownRenderer) Render(ns *Notes) (string, error) {
+	return execute(defaultTemplate, ns)
+}
+
+// HTMLRenderer renders the notes as an HTML fragment, with links to the PRs
+// and users.
+type HTMLRenderer struct{}
+
+// Render implements Renderer.
+func (HTMLRenderer) Render(ns *Notes) (string, error) {
+	var b strings.Builder
+	writeEntries := func(entries []*Entry, indent string) {
+		for _, entry := range entries {
+			fmt.Fprintf(&b, "%v<li>%v (<a href=\"%v\">#%v</a>)", indent, html.EscapeString(entry.Title), html.EscapeString(entry.HTMLURL), entry.IssueNumber)
+			if entry.SpecialThanks {
+				fmt.Fprintf(&b, "\n%v  <ul><li>Special Thanks: <a href=\"%v\">@%v</a></li></ul>\n%v", indent, html.EscapeString(entry.User.HTMLURL), html.EscapeString(entry.User.Login), indent)
+			}
+			b.WriteString("</li>\n")
+		}
+	}
+	for _, section := range ns.Sections {
+		fmt.Fprintf(&b, "<h1>%v</h1>\n<ul>\n", html.EscapeString(section.Name))
+		if len(section.Subsections) == 0 {
+			writeEntries(section.Entries, "  ")
+		}
+		for _, ss := range section.Subsections {
+			if ss.Name == "" {
+				writeEntries(ss.Entries, "  ")
+				continue
+			}
+			fmt.Fprintf(&b, "  <li>%v\n    <ul>\n", html.EscapeString(ss.Name))
+			writeEntries(ss.Entries, "      ")
+			b.WriteString("    </ul>\n  </li>\n")
+		}
+		b.WriteString("</ul>\n")
+	}
+	if cs := ns.Contributors; cs != nil {
+		link := func(u *User) string {
+			return fmt.Sprintf("<a href=\"%v\">@%v</a>", html.EscapeString(u.HTMLURL), html.EscapeString(u.Login))
+		}
+		fmt.Fprintf(&b, "<h1>Contributors</h1>\n<p>%v%v</p>\n", thanksContributors, joinUsers(cs.All, link))
+		if len(cs.New) > 0 {
+			fmt.Fprintf(&b, "<p>%v%v</p>\n", welcomeContributors, joinUsers(cs.New, link))
+		}
+	}
+	return b.String(), nil
+}
+
+// JSONRenderer renders the notes as indented JSON, with all the fields of
+// Notes.
+type JSONRenderer struct{}
+
+// Render implements Renderer.
+func (JSONRenderer) Render(ns *Notes) (string, error) {
+	b, err := json.MarshalIndent(ns, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal notes: %v", err)
+	}
+	return string(b) + "\n", nil
+}
+
+// TextRenderer renders the notes as plain text, e.g. for emails.
+type TextRenderer struct{}
+
+// Render implements Renderer.
+func (TextRenderer) Render(ns *Notes) (string, error) {
+	var b strings.Builder
+	writeEntries := func(entries []*Entry, indent string) {
+		for _, entry := range entries {
+			fmt.Fprintf(&b, "%v- %v (#%v)\n", indent, entry.Title, entry.IssueNumber)
+			if entry.SpecialThanks {
+				fmt.Fprintf(&b, "%v  Special Thanks: @%v\n", indent, entry.User.Login)
+			}
+		}
+	}
+	for _, section := range ns.Sections {
+		fmt.Fprintf(&b, "%v\n%v\n\n", section.Name, strings.Repeat("-", len(section.Name)))
+		if len(section.Subsections) == 0 {
+			writeEntries(section.Entries, "  ")
+		}
+		for _, ss := range section.Subsections {
+			if ss.Name == "" {
+				writeEntries(ss.Entries, "  ")
+				continue
+			}
+			fmt.Fprintf(&b, "  - %v\n", ss.Name)
+			writeEntries(ss.Entries, "    ")
+		}
+		b.WriteString("\n")
+	}
+	if cs := ns.Contributors; cs != nil {
+		mention := func(u *User) string { return "@" + u.Login }
+		fmt.Fprintf(&b, "Contributors\n------------\n\n%v%v\n", thanksContributors, joinUsers(cs.All, mention))
+		if len(cs.New) > 0 {
+			fmt.Fprintf(&b, "%v%v\n", welcomeContributors, joinUsers(cs.New, mention))
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// SlackRenderer renders the notes in Slack's mrkdwn, for chat announcements.
+// Slack doesn't render lists, so the entries are prefixed with bullets, and
+// the entries in subsections are indented under the area name.
+type SlackRenderer struct{}
+
+// slackEscaper escapes the characters Slack uses for links and mentions.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Render implements Renderer.
+func (SlackRenderer) Render(ns *Notes) (string, error) {
+	var b strings.Builder
+	writeEntries := func(entries []*Entry, indent, bullet, subBullet string) {
+		for _, entry := range entries {
+			fmt.Fprintf(&b, "%v%v %v (<%v|#%v>)\n", indent, bullet, slackEscaper.Replace(entry.Title), entry.HTMLURL, entry.IssueNumber)
+			if entry.SpecialThanks {
+				fmt.Fprintf(&b, "%v    %v Special Thanks: <%v|@%v>\n", indent, subBullet, entry.User.HTMLURL, slackEscaper.Replace(entry.User.Login))
+			}
+		}
+	}
+	for _, section := range ns.Sections {
+		fmt.Fprintf(&b, "*%v*\n", slackEscaper.Replace(section.Name))
+		if len(section.Subsections) == 0 {
+			writeEntries(section.Entries, "", "•", "◦")
+		}
+		for _, ss := range section.Subsections {
+			if ss.Name == "" {
+				writeEntries(ss.Entries, "", "•", "◦")
+				continue
+			}
+			fmt.Fprintf(&b, "• _%v_\n", slackEscaper.Replace(ss.Name))
+			writeEntries(ss.Entries, "    ", "◦", "▪")
+		}
+		b.WriteString("\n")
+	}
+	if cs := ns.Contributors; cs != nil {
+		link := func(u *User) string { return fmt.Sprintf("<%v|@%v>", u.HTMLURL, slackEscaper.Replace(u.Login)) }
+		fmt.Fprintf(&b, "*Contributors*\n%v%v\n", thanksContributors, joinUsers(cs.All, link))
+		if len(cs.New) > 0 {
+			fmt.Fprintf(&b, "%v%v\n", welcomeContributors, joinUsers(cs.New, link))
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,160 @@
+package notes
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// testNotes returns notes with an entry with special thanks, an entry grouped
+// by area, and the contributors.
+func testNotes() *Notes {
+	alice := &User{Login: "alice", HTMLURL: "https://github.com/alice"}
+	bob := &User{Login: "bob", HTMLURL: "https://github.com/bob"}
+	crash := &Entry{
+		IssueNumber:   1,
+		Title:         "Fix a crash",
+		HTMLURL:       "https://github.com/grpc/grpc-go/pull/1",
+		User:          alice,
+		SpecialThanks: true,
+	}
+	leak := &Entry{
+		IssueNumber: 2,
+		Title:       "Fix <a> leak",
+		HTMLURL:     "https://github.com/grpc/grpc-go/pull/2",
+		Area:        "transport",
+		User:        bob,
+	}
+	return &Notes{
+		Org:     "grpc",
+		Repo:    "grpc-go",
+		Version: "1.0.0",
+		Sections: []*Section{{
+			Name:      "Bug Fixes",
+			LabelName: "Bug",
+			Entries:   []*Entry{crash, leak},
+			Subsections: []*Subsection{
+				{Entries: []*Entry{crash}},
+				{Name: "transport", Entries: []*Entry{leak}},
+			},
+		}},
+		Contributors: &Contributors{All: []*User{alice, bob}, New: []*User{bob}},
+	}
+}
+
+func TestRenderers(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		want   string
+	}{
+		{
+			format: "markdown",
+			want: "# Bug Fixes\n\n" +
+				" * Fix a crash (#1)\n   - Special Thanks: @alice\n" +
+				" * transport\n   * Fix <a> leak (#2)\n\n" +
+				"# Contributors\n\n" +
+				"Thanks to everyone who contributed to this release: @alice, @bob\n\n" +
+				"Welcome to the new contributors: @bob\n\n",
+		},
+		{
+			format: "html",
+			want: "<h1>Bug Fixes</h1>\n<ul>\n" +
+				"  <li>Fix a crash (<a href=\"https://github.com/grpc/grpc-go/pull/1\">#1</a>)\n" +
+				"    <ul><li>Special Thanks: <a href=\"https://github.com/alice\">@alice</a></li></ul>\n  </li>\n" +
+				"  <li>transport\n    <ul>\n" +
+				"      <li>Fix &lt;a&gt; leak (<a href=\"https://github.com/grpc/grpc-go/pull/2\">#2</a>)</li>\n" +
+				"    </ul>\n  </li>\n</ul>\n" +
+				"<h1>Contributors</h1>\n" +
+				"<p>Thanks to everyone who contributed to this release: <a href=\"https://github.com/alice\">@alice</a>, <a href=\"https://github.com/bob\">@bob</a></p>\n" +
+				"<p>Welcome to the new contributors: <a href=\"https://github.com/bob\">@bob</a></p>\n",
+		},
+		{
+			format: "text",
+			want: "Bug Fixes\n---------\n\n" +
+				"  - Fix a crash (#1)\n    Special Thanks: @alice\n" +
+				"  - transport\n    - Fix <a> leak (#2)\n\n" +
+				"Contributors\n------------\n\n" +
+				"Thanks to everyone who contributed to this release: @alice, @bob\n" +
+				"Welcome to the new contributors: @bob\n\n",
+		},
+		{
+			format: "slack",
+			want: "*Bug Fixes*\n" +
+				"• Fix a crash (<https://github.com/grpc/grpc-go/pull/1|#1>)\n" +
+				"    ◦ Special Thanks: <https://github.com/alice|@alice>\n" +
+				"• _transport_\n" +
+				"    ◦ Fix &lt;a&gt; leak (<https://github.com/grpc/grpc-go/pull/2|#2>)\n\n" +
+				"*Contributors*\n" +
+				"Thanks to everyone who contributed to this release: <https://github.com/alice|@alice>, <https://github.com/bob|@bob>\n" +
+				"Welcome to the new contributors: <https://github.com/bob|@bob>\n\n",
+		},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			r, err := RendererForFormat(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := r.Render(testNotes())
+			if err != nil || got != tt.want {
+				t.Errorf("Render() = %q, %v, want:\n%q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONRenderer(t *testing.T) {
+	want := testNotes()
+	s, err := JSONRenderer{}.Render(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Notes
+	if err := json.Unmarshal([]byte(s), &got); err != nil {
+		t.Fatalf("failed to unmarshal %q: %v", s, err)
+	}
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("notes unmarshaled from json:\n%+v\nwant:\n%+v", &got, want)
+	}
+}
+
+func TestTemplateRenderer(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "links",
+			text: `{{range .Sections}}{{range .Entries}}{{prLink .}} {{userLink .User}}
+{{end}}{{end}}`,
+			want: "[#1](https://github.com/grpc/grpc-go/pull/1) [@alice](https://github.com/alice)\n" +
+				"[#2](https://github.com/grpc/grpc-go/pull/2) [@bob](https://github.com/bob)\n",
+		},
+		{
+			name: "pluralize",
+			text: `{{range .Sections}}{{len .Entries}} {{pluralize (len .Entries) "change" "changes"}}, {{len .Subsections}} {{pluralize 1 "area" "areas"}}{{end}}`,
+			want: "2 changes, 2 area",
+		},
+		{
+			name: "authors",
+			text: `{{range .Sections}}{{join ", " (authors .Entries)}}; {{join ", " (thanked .Entries)}}{{end}}`,
+			want: "alice, bob; alice",
+		},
+		{
+			name: "mentions",
+			text: `{{with .Contributors}}{{mentions .All}}; {{mentions .New}}{{end}}`,
+			want: "@alice, @bob; @bob",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewTemplateRenderer(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := r.Render(testNotes())
+			if err != nil || got != tt.want {
+				t.Errorf("Render() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
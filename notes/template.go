@@ -0,0 +1,116 @@
+package notes
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// DefaultTemplate is the template of the markdown notes, see
+// MarkdownRenderer. Copy it to start a custom template. The entries grouped by
+// area are nested in a list item with the area name, after the entries
+// without an area. The contributors are in a section at the end.
+const DefaultTemplate = `{{define "entries"}}{{range .}} * {{.Title}} (#{{.IssueNumber}})
+{{if .SpecialThanks}}   - Special Thanks: @{{.User.Login}}
+{{end}}{{end}}{{end}}
+{{- define "subentries"}}{{range .}}   * {{.Title}} (#{{.IssueNumber}})
+{{if .SpecialThanks}}     - Special Thanks: @{{.User.Login}}
+{{end}}{{end}}{{end}}
+{{- range .Sections}}# {{.Name}}
+
+{{if .Subsections}}{{range .Subsections}}{{if .Name}} * {{.Name}}
+{{template "subentries" .Entries}}{{else}}{{template "entries" .Entries}}{{end}}{{end}}
+{{- else}}{{template "entries" .Entries}}{{end}}
+{{end}}
+{{- with .Contributors}}# Contributors
+
+Thanks to everyone who contributed to this release: {{mentions .All}}
+{{with .New}}
+Welcome to the new contributors: {{mentions .}}
+{{end}}
+{{end}}`
+
+// TemplateFuncs are the helper functions available in the templates, in
+// addition to the text/template builtins:
+//
+//	prLink entry                  the markdown link to the PR, [#123](url)
+//	userLink user                 the markdown link to the user, [@login](url)
+//	pluralize n singular plural   singular if n is 1, plural otherwise
+//	join sep strings              the strings joined with sep
+//	authors entries               the logins of the entries' authors
+//	thanked entries               the logins of the authors with special thanks
+//	mentions users                the users' @logins, joined with ", "
+//
+// authors and thanked keep the order of the entries, without duplicates.
+var TemplateFuncs = template.FuncMap{
+	"prLink": func(e *Entry) string {
+		return fmt.Sprintf("[#%v](%v)", e.IssueNumber, e.HTMLURL)
+	},
+	"userLink": func(u *User) string {
+		return fmt.Sprintf("[@%v](%v)", u.Login, u.HTMLURL)
+	},
+	"pluralize": func(n int, singular, plural string) string {
+		if n == 1 {
+			return singular
+		}
+		return plural
+	},
+	"join": func(sep string, elems []string) string {
+		return strings.Join(elems, sep)
+	},
+	"authors": func(entries []*Entry) []string {
+		return logins(entries, func(*Entry) bool { return true })
+	},
+	"thanked": func(entries []*Entry) []string {
+		return logins(entries, func(e *Entry) bool { return e.SpecialThanks })
+	},
+	"mentions": func(users []*User) string {
+		return joinUsers(users, func(u *User) string { return "@" + u.Login })
+	},
+}
+
+// logins returns the logins of the authors of the entries that pass filter,
+// without duplicates.
+func logins(entries []*Entry, filter func(*Entry) bool) []string {
+	var ret []string
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if e.User == nil || !filter(e) || seen[e.User.Login] {
+			continue
+		}
+		seen[e.User.Login] = true
+		ret = append(ret, e.User.Login)
+	}
+	return ret
+}
+
+var defaultTemplate = template.Must(template.New("notes").Funcs(TemplateFuncs).Parse(DefaultTemplate))
+
+// TemplateRenderer renders the notes with a text/template. The template is
+// executed with the Notes, so all the fields of Notes, Section and Entry can
+// be used, along with TemplateFuncs.
+type TemplateRenderer struct {
+	t *template.Template
+}
+
+// NewTemplateRenderer parses the template text, see TemplateRenderer.
+func NewTemplateRenderer(text string) (*TemplateRenderer, error) {
+	t, err := template.New("notes").Funcs(TemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse release notes template: %v", err)
+	}
+	return &TemplateRenderer{t: t}, nil
+}
+
+// Render implements Renderer.
+func (r *TemplateRenderer) Render(ns *Notes) (string, error) {
+	return execute(r.t, ns)
+}
+
+func execute(t *template.Template, ns *Notes) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, ns); err != nil {
+		return "", fmt.Errorf("failed to render release notes template: %v", err)
+	}
+	return b.String(), nil
+}
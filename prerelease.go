@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/menghanl/release-git-bot/ghclient"
+)
+
+var rc = new(bool)
+
+func prereleaseFlags(fs *flag.FlagSet) {
+	fs.BoolVar(rc, "rc", false, "if true, cut the next release candidate of -version, e.g. 1.15.0-rc.2 if 1.15.0-rc.1 was tagged, instead of the final release")
+}
+
+// nextPrerelease returns the next pre-release version of ver, numbered after
+// the pre-release tags of ver that exist in the repo. The pre-release format is
+// prerelease_format from the config.
+func nextPrerelease(ctx context.Context, c *ghclient.Client, ver semver.Version) (semver.Version, error) {
+	if len(ver.Pre) > 0 {
+		return ver, fmt.Errorf("version %v is already a pre-release", ver)
+	}
+	if strings.Count(cfg.PrereleaseFormat, "%v") != 1 {
+		return ver, fmt.Errorf("prerelease_format %q must contain exactly one %%v", cfg.PrereleaseFormat)
+	}
+	tags, err := c.ListTags(ctx)
+	if err != nil {
+		return ver, err
+	}
+
+	// For example, ^v1\.15\.0-rc\.(\d+)$.
+	prefix := regexp.QuoteMeta("v" + ver.String() + "-")
+	parts := strings.Split(cfg.PrereleaseFormat, "%v")
+	re := regexp.MustCompile("^" + prefix + regexp.QuoteMeta(parts[0]) + `(\d+)` + regexp.QuoteMeta(parts[1]) + "$")
+	var last int
+	for _, t := range tags {
+		m := re.FindStringSubmatch(t)
+		if m == nil {
+			continue
+		}
+		if n, _ := strconv.Atoi(m[1]); n > last {
+			last = n
+		}
+	}
+
+	pre := fmt.Sprintf(cfg.PrereleaseFormat, last+1)
+	ret, err := semver.Make(ver.String() + "-" + pre)
+	if err != nil {
+		return ver, fmt.Errorf("invalid pre-release version from prerelease_format %q: %v", cfg.PrereleaseFormat, err)
+	}
+	return ret, nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blang/semver"
+	"github.com/menghanl/release-git-bot/ghclient"
+	"github.com/menghanl/release-git-bot/gitwrapper"
+)
+
+// releaser runs the release steps and keeps track of the progress.
+type releaser struct {
+	upstream *ghclient.Client
+	local    *gitwrapper.Repo
+
+	ver semver.Version
+	// login is the owner of the fork the changes are pushed to, and the PRs
+	// are sent from.
+	login string
+	// name and email are the commit author.
+	name  string
+	email string
+
+	state *releaseState
+	// recordedBranches are the upstream branches that were only recorded in
+	// dry run, to the SHA they would be created at.
+	recordedBranches map[string]string
+}
+
+// close releases the clone of the fork, if there's one.
+func (r *releaser) close() {
+	if r.local != nil {
+		r.local.Close()
+	}
+}
+
+// releaseStep is one step in the release flow.
+//
+// A step is only marked completed after run returns without error, so
+// resuming a release starts from the first step that didn't finish.
+type releaseStep struct {
+	name string
+	run  func(r *releaser, ctx context.Context) error
+	// skip, if not nil, returns a reason to skip this step for this release,
+	// or "" if the step should run.
+	skip func(r *releaser) string
+}
+
+var releaseSteps = []releaseStep{
+	{name: "release-branch", run: (*releaser).createReleaseBranch},
+	{name: "version-pr", run: (*releaser).makeVersionPR},
+	{name: "version-pr-merged", run: (*releaser).waitVersionPRMerged},
+	{name: "draft-release", run: (*releaser).createDraftRelease},
+	{name: "release-published", run: (*releaser).waitReleasePublished},
+	{name: "release-branch-dev-pr", run: (*releaser).makeReleaseBranchDevPR, skip: skipForPrerelease},
+	{name: "master-dev-pr", run: (*releaser).makeMasterDevPR, skip: skipForPatchOrPrerelease},
+}
+
+func skipForPrerelease(r *releaser) string {
+	if r.isPrerelease() {
+		return "the -dev version is only changed after the final release"
+	}
+	return ""
+}
+
+func skipForPatchOrPrerelease(r *releaser) string {
+	if reason := skipForPrerelease(r); reason != "" {
+		return reason
+	}
+	if r.isPatchRelease() {
+		return "not needed for patch releases"
+	}
+	return ""
+}
+
+// isPrerelease returns whether this is a pre-release, e.g. 1.15.0-rc.1.
+func (r *releaser) isPrerelease() bool {
+	return len(r.ver.Pre) > 0
+}
+
+// isPatchRelease returns whether this is a patch release, e.g. 1.14.1, which
+// is made on the existing release branch.
+func (r *releaser) isPatchRelease() bool {
+	return r.ver.Patch > 0
+}
+
+// run runs all the steps that haven't been completed.
+func (r *releaser) run(ctx context.Context) error {
+	if err := r.state.save(); err != nil {
+		return fmt.Errorf("failed to save state: %v", err)
+	}
+	for _, s := range releaseSteps {
+		if r.state.isCompleted(s.name) {
+			fmt.Printf(" - Skipping %q, already completed\n", s.name)
+			continue
+		}
+		if s.skip != nil {
+			if reason := s.skip(r); reason != "" {
+				fmt.Printf(" - Skipping %q, %v\n", s.name, reason)
+				// Skipped steps count as completed, so the release is
+				// finished when all steps are completed.
+				if err := r.state.markCompleted(s.name); err != nil {
+					return fmt.Errorf("failed to save state after skipping step %q: %v", s.name, err)
+				}
+				continue
+			}
+		}
+		fmt.Println()
+		if err := s.run(r, ctx); err != nil {
+			return fmt.Errorf("step %q failed: %v", s.name, err)
+		}
+		if err := r.state.markCompleted(s.name); err != nil {
+			return fmt.Errorf("failed to save state after step %q: %v", s.name, err)
+		}
+	}
+	return nil
+}
+
+/* Step 1: create an upstream release branch if it doesn't exist */
+func (r *releaser) createReleaseBranch(ctx context.Context) error {
+	if r.isPatchRelease() {
+		fmt.Printf(" - Step 1: patch release, check the upstream release branch %v/%v/%v exists\n\n", r.upstream.Owner(), r.upstream.Repo(), r.state.ReleaseBranch)
+		exists, err := r.upstream.BranchExists(ctx, r.state.ReleaseBranch)
+		if err != nil {
+			return fmt.Errorf("failed to check release branch: %v", err)
+		}
+		if !exists {
+			return fmt.Errorf("release branch %v doesn't exist, a patch release must be made on an existing release branch", r.state.ReleaseBranch)
+		}
+		return nil
+	}
+	fmt.Printf(" - Step 1: create an upstream release branch %v/%v/%v\n\n", r.upstream.Owner(), r.upstream.Repo(), r.state.ReleaseBranch)
+	sha, err := r.upstream.NewBranchFromHead(ctx, r.state.ReleaseBranch)
+	if err != nil {
+		return err
+	}
+	if recorder != nil && sha != "" {
+		r.recordedBranches = map[string]string{r.state.ReleaseBranch: sha}
+	}
+	return nil
+}
+
+/* Step 2: on release branch, change version file to 1.release.0 */
+func (r *releaser) makeVersionPR(ctx context.Context) error {
+	fmt.Printf(" - Step 2: on release branch, change version to %v\n\n", r.ver.String())
+	prURL, err := r.makePR(ctx, r.ver.String(), r.state.ReleaseBranch)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("PR %v created, merge before continuing...\n", prURL)
+	return nil
+}
+
+/* Wait for the PR to be merged */
+func (r *releaser) waitVersionPRMerged(ctx context.Context) error {
+	prURL := r.state.PRURLs[r.ver.String()]
+	fmt.Printf("Waiting for PR %v to be merged\n", prURL)
+	return waitPRMerged(ctx, r.upstream, prURL)
+}
+
+/* Step 3: generate release note and create draft release */
+func (r *releaser) createDraftRelease(ctx context.Context) error {
+	fmt.Printf(" - Step 3: generate release note and create draft release\n\n")
+	// Check the template before the notes are generated.
+	renderer, err := notesRenderer("markdown")
+	if err != nil {
+		return err
+	}
+	// Get and print the markdown release notes.
+	ns, err := releaseNote(ctx, r.upstream, r.ver)
+	if err != nil {
+		return fmt.Errorf("failed to generate release notes: %v", err)
+	}
+	markdownNote, err := renderer.Render(ns)
+	if err != nil {
+		return err
+	}
+
+	releaseTitle := fmt.Sprintf("Release %v", r.ver.String())
+	newDraftRelease := r.upstream.NewDraftRelease
+	if r.isPrerelease() {
+		newDraftRelease = r.upstream.NewDraftPrerelease
+	}
+	releaseURL, err := newDraftRelease(ctx, "v"+r.ver.String(), r.state.ReleaseBranch, releaseTitle, markdownNote)
+	if err != nil {
+		return fmt.Errorf("failed to create release: %v", err)
+	}
+	r.state.ReleaseURL = releaseURL
+	fmt.Printf("Draft release %v created, publish before continuing\n", releaseURL)
+	return nil
+}
+
+/* Wait for the release to be published */
+func (r *releaser) waitReleasePublished(ctx context.Context) error {
+	fmt.Printf("Waiting for release %v to be published\n", r.state.ReleaseURL)
+	return waitReleasePublished(ctx, r.upstream, "v"+r.ver.String())
+}
+
+/* Step 4: on release branch, change version file to 1.release.1-dev */
+func (r *releaser) makeReleaseBranchDevPR(ctx context.Context) error {
+	nextMinorRelease := r.ver
+	nextMinorRelease.Patch++ // Increment the pateh version, not the minor version.
+	nextMinorReleaseStr := fmt.Sprintf("%v-dev", nextMinorRelease.String())
+	fmt.Printf(" - Step 4: on release branch, change version to %v\n\n", nextMinorReleaseStr)
+	prURL, err := r.makePR(ctx, nextMinorReleaseStr, r.state.ReleaseBranch)
+	if err != nil {
+		return err
+	}
+	fmt.Println("PR to merge: ", prURL)
+	return nil
+}
+
+/* Step 5: on master branch, change version file to 1.release+1.0-dev */
+func (r *releaser) makeMasterDevPR(ctx context.Context) error {
+	nextMajorRelease := r.ver
+	nextMajorRelease.Minor++ // Increment the minor version, not the major version.
+	nextMajorReleaseStr := fmt.Sprintf("%v-dev", nextMajorRelease.String())
+	fmt.Printf(" - Step 5: on %v branch, change version to %v\n\n", cfg.BaseBranch, nextMajorReleaseStr)
+	prURL, err := r.makePR(ctx, nextMajorReleaseStr, cfg.BaseBranch)
+	if err != nil {
+		return err
+	}
+	fmt.Println("PR to merge: ", prURL)
+	return nil
+}
+
+// makePR makes the version change, pushes it to the user's fork and sends a
+// pull request to upstreamBranchName. The PR URL is recorded in the state.
+//
+// return value is pr URL.
+func (r *releaser) makePR(ctx context.Context, newVersionStr, upstreamBranchName string) (string, error) {
+	/* Step 1: make version change locally */
+	branchName := fmt.Sprintf("release_version_%v", newVersionStr)
+	// Base the change on the upstream branch, not on the fork's, which may be
+	// behind, or not exist for release branches.
+	fetchBranch, baseCommit := upstreamBranchName, ""
+	if sha, ok := r.recordedBranches[upstreamBranchName]; ok {
+		// Dry run, the branch doesn't exist. Base the change on the commit it
+		// would be created at, on the base branch.
+		fetchBranch, baseCommit = cfg.BaseBranch, sha
+	}
+	if err := r.local.FetchRemoteBranch(upstreamRemote, fetchBranch); err != nil {
+		return "", err
+	}
+	var versionFiles []*gitwrapper.VersionFile
+	for _, f := range cfg.VersionFiles {
+		versionFiles = append(versionFiles, &gitwrapper.VersionFile{
+			Path:    f.Path,
+			GoConst: f.GoConst,
+			Pattern: f.Pattern,
+		})
+	}
+	if err := r.local.MakeVersionChange(&gitwrapper.VersionChangeConfig{
+		VersionFiles: versionFiles,
+		NewVersion:   newVersionStr,
+		BranchName:   branchName,
+		BaseBranch:   upstreamBranchName,
+		BaseRemote:   upstreamRemote,
+		BaseCommit:   baseCommit,
+		UserName:     r.name,
+		UserEmail:    r.email,
+		SkipCI:       upstreamBranchName != cfg.BaseBranch, // Not skip if upstreamBranchName is the base branch
+	}); err != nil {
+		return "", fmt.Errorf("failed to make change: %v", err)
+	}
+
+	/* Step 2: push to fork and send pull request to upstream/release_branch with the change */
+	prTitle := fmt.Sprintf("Change version to %v", newVersionStr)
+	prURL, err := r.publish(ctx, branchName, upstreamBranchName, prTitle, "")
+	if err != nil {
+		return "", err
+	}
+	r.state.PRURLs[newVersionStr] = prURL
+	return prURL, nil
+}
+
+// publish pushes the local branch to the user's fork, and sends a pull request
+// from it to the upstream branch.
+//
+// return value is pr URL.
+func (r *releaser) publish(ctx context.Context, branchName, upstreamBranchName, title, body string) (string, error) {
+	if err := r.local.Publish(&gitwrapper.PublicConfig{
+		// This could push to upstream directly, but to be safe, we send pull
+		// request instead.
+		RemoteName: "",
+		Auth:       gitAuth(r.login),
+	}); err != nil {
+		return "", fmt.Errorf("failed to public change: %v", err)
+	}
+
+	prURL, err := r.upstream.NewPullRequest(ctx, r.login, branchName, upstreamBranchName, title, body)
+	if err != nil {
+		return "", fmt.Errorf("failed to create pull request: %v", err)
+	}
+	return prURL, nil
+}
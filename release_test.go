@@ -0,0 +1,758 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/google/go-github/github"
+	"github.com/menghanl/release-git-bot/config"
+	"github.com/menghanl/release-git-bot/dryrun"
+	"github.com/menghanl/release-git-bot/internal/fakegithub"
+	"github.com/menghanl/release-git-bot/notes"
+)
+
+const (
+	testUpstream = "grpc"
+	testRepo     = "grpc-go"
+	testUser     = "gopher"
+)
+
+const testVersionFile = `package grpc
+
+// Version is the current grpc version.
+const Version = "1.14.0-dev"
+`
+
+// testNotesTemplate is the release notes template for 1.14.1, with the helper
+// functions.
+const testNotesTemplate = `{{range .Sections}}## {{.Name}} ({{len .Entries}} {{pluralize (len .Entries) "change" "changes"}})
+{{range .Entries}}- {{.Title}} {{prLink .}}
+{{end}}{{with thanked .Entries}}Thanks {{join ", " .}}!
+{{end}}{{end}}`
+
+// saveGlobals restores the variables ptrs point to when the test ends. The
+// flags and the package state are globals, so the tests must not leak their
+// changes to the other tests.
+func saveGlobals(t *testing.T, ptrs ...interface{}) {
+	for _, p := range ptrs {
+		v := reflect.ValueOf(p).Elem()
+		old := reflect.New(v.Type()).Elem()
+		old.Set(v)
+		t.Cleanup(func() { v.Set(old) })
+	}
+}
+
+// newTestFake starts a fake github with the upstream repo and the user's
+// fork, and points the bot at it with a token.
+func newTestFake(t *testing.T) *fakegithub.Server {
+	saveGlobals(t,
+		&cfg, &upstreamUser, &recorder, &tokenSource, &app,
+		token, appID, appInstallationID, appKeyFile, repo, newVersion,
+		workdir, syncFork, thanks, contributors, yes, concurrency,
+		pollInterval, pollTimeout, dryRun, since,
+	)
+
+	fake, err := fakegithub.New()
+	if err != nil {
+		t.Fatalf("failed to start fake github: %v", err)
+	}
+	t.Cleanup(fake.Close)
+	fake.AutoMerge = true
+	fake.AutoPublish = true
+	if err := setupFake(fake); err != nil {
+		t.Fatalf("failed to set up fake github: %v", err)
+	}
+
+	cfg = config.Default()
+	cfg.UpstreamUser = testUpstream
+	cfg.APIURL = fake.URL
+	cfg.GitURL = fake.GitURL
+	upstreamUser = testUpstream
+	*repo = testRepo
+	*token = "fake-token"
+	if err := initAuth(); err != nil {
+		t.Fatal(err)
+	}
+	*thanks = true
+	*contributors = true
+	*yes = true
+	*concurrency = 4
+	*pollInterval = 10 * time.Millisecond
+	*pollTimeout = 10 * time.Second
+	return fake
+}
+
+// setupFake creates the upstream repo with a milestone of merged PRs, and the
+// user's fork.
+func setupFake(fake *fakegithub.Server) error {
+	fake.SetUser(testUser, testUser+"@example.com")
+	fake.AddOrgMembers(testUpstream, "member")
+	if err := fake.CreateRepo(testUpstream, testRepo, map[string]string{"version.go": testVersionFile}); err != nil {
+		return err
+	}
+	if err := fake.Tag(testUpstream, testRepo, "v1.13.0", "master"); err != nil {
+		return err
+	}
+	milestone := fmt.Sprintf(config.Default().MilestoneFormat, 1, 14)
+	// More PRs than fit in one page, so the PRs below are only found if all
+	// the pages are read.
+	for i := 0; i < 150; i++ {
+		if _, err := fake.AddPR(testUpstream, testRepo, &fakegithub.PR{
+			Title:     fmt.Sprintf("Clean up %v", i),
+			Author:    "member",
+			Labels:    []string{"Type: Internal Cleanup"},
+			Milestone: milestone,
+			Merged:    true,
+		}); err != nil {
+			return err
+		}
+	}
+	for _, pr := range []*fakegithub.PR{
+		{Title: "Add a feature", Author: "contributor", Labels: []string{"Type: Feature"}, Merged: true},
+		{Title: "Fix a bug", Author: "member", Labels: []string{"Type: Bug"}, Merged: true},
+		{Title: "Clean up", Author: "member", Labels: []string{"Type: Internal Cleanup"}, Merged: true},
+		{Title: "Not for the notes", Author: "member", Labels: []string{"no release notes"}, Merged: true},
+		{Title: "Never merged", Author: "contributor", Labels: []string{"Type: Feature"}},
+	} {
+		pr.Milestone = milestone
+		if _, err := fake.AddPR(testUpstream, testRepo, pr); err != nil {
+			return err
+		}
+	}
+	if _, err := fake.AddIssue(testUpstream, testRepo, "An issue", milestone); err != nil {
+		return err
+	}
+	if err := fake.Fork(testUpstream, testRepo, testUser); err != nil {
+		return err
+	}
+	// Upstream moves ahead of the fork, the changes must still be based on
+	// upstream.
+	_, err := fake.Commit(testUpstream, testRepo, "master", "Add upstream.go", map[string]string{"upstream.go": "package grpc\n"})
+	return err
+}
+
+// useApp installs a github app in the fake, and makes the bot authenticate as
+// it instead of with a token.
+func useApp(t *testing.T, fake *fakegithub.Server) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.SetApp(1, 2, "release-bot", &key.PublicKey)
+
+	keyFile := filepath.Join(t.TempDir(), "app-key.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(keyFile, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	*token = ""
+	*appID = 1
+	*appInstallationID = 2
+	*appKeyFile = keyFile
+	if err := initAuth(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestReleaser returns a releaser for a new release of version.
+func newTestReleaser(ctx context.Context, version string) (*releaser, error) {
+	*newVersion = version
+	state := newReleaseState("")
+	state.Version = version
+	state.UpstreamUser = upstreamUser
+	state.Repo = *repo
+	return newReleaser(ctx, state, true)
+}
+
+// runTestRelease runs all the release steps for version.
+func runTestRelease(ctx context.Context, version string) error {
+	r, err := newTestReleaser(ctx, version)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	if err := r.run(ctx); err != nil {
+		return fmt.Errorf("release %v failed: %v", version, err)
+	}
+	return nil
+}
+
+// addMergedPR adds a merged PR, merged with a commit on the upstream branch.
+// msg is the commit message, with %v for the PR number, or "" for no commit.
+func addMergedPR(t *testing.T, fake *fakegithub.Server, branch, msg string, pr *fakegithub.PR) int {
+	pr.Merged = true
+	num, err := fake.AddPR(testUpstream, testRepo, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg == "" {
+		return num
+	}
+	if strings.Contains(msg, "%v") {
+		msg = fmt.Sprintf(msg, num)
+	}
+	sha, err := fake.Commit(testUpstream, testRepo, branch, msg, map[string]string{fmt.Sprintf("pr%v.go", num): "package grpc\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.SetMergeCommit(testUpstream, testRepo, num, sha); err != nil {
+		t.Fatal(err)
+	}
+	return num
+}
+
+// TestRelease runs releases and a patch release against a fake github, and
+// checks the branches, PRs and releases made. The subtests check the notes of
+// the next release, on the branches left by the releases.
+func TestRelease(t *testing.T) {
+	ctx := context.Background()
+	fake := newTestFake(t)
+
+	checkFile := func(branch, want string) {
+		t.Helper()
+		got, err := fake.File(testUser, testRepo, branch, "version.go")
+		if err != nil || !strings.Contains(got, want) {
+			t.Errorf("%v in the fork: want version %v, got %q, err %v", branch, want, got, err)
+		}
+	}
+
+	// The client must retry these.
+	fake.InjectErrors(1, http.StatusForbidden, 1)
+	fake.InjectErrors(2, http.StatusBadGateway, 0)
+
+	// Keep the fork's clone on disk, the later releases with the same fork
+	// reuse it.
+	dir := t.TempDir()
+	*workdir = dir
+	clone := filepath.Join(dir, testUser, testRepo)
+	checkClone := func() {
+		t.Helper()
+		if _, err := os.Stat(filepath.Join(clone, ".git")); err != nil {
+			t.Errorf("no clone in %v: %v", clone, err)
+		}
+		if _, err := os.Stat(clone + ".lock"); !os.IsNotExist(err) {
+			t.Errorf("%v is still locked after the release: %v", clone, err)
+		}
+	}
+
+	t.Log("Release 1.14.0")
+	if err := runTestRelease(ctx, "1.14.0"); err != nil {
+		t.Fatal(err)
+	}
+	checkClone()
+	checkFile("release_version_1.14.0", `"1.14.0"`)
+	checkFile("release_version_1.14.1-dev", `"1.14.1-dev"`)
+	checkFile("release_version_1.15.0-dev", `"1.15.0-dev"`)
+	checkPRs(t, fake, map[string]string{
+		"Change version to 1.14.0":     "v1.14.x",
+		"Change version to 1.14.1-dev": "v1.14.x",
+		"Change version to 1.15.0-dev": "master",
+	})
+	notes := checkRelease(t, fake, "v1.14.0")
+	if !strings.Contains(notes, "Add a feature (#") {
+		t.Errorf("1.14.0 notes don't have the feature PR:\n%v", notes)
+	}
+	if !strings.Contains(notes, "Special Thanks: @contributor") {
+		t.Errorf("1.14.0 notes don't thank the contributor:\n%v", notes)
+	}
+	if strings.Contains(notes, "@member") {
+		t.Errorf("1.14.0 notes thank an org member:\n%v", notes)
+	}
+	if strings.Contains(notes, "Not for the notes") {
+		t.Errorf("1.14.0 notes have a PR without release notes:\n%v", notes)
+	}
+	if _, err := fake.File(testUser, testRepo, "release_version_1.15.0-dev", "upstream.go"); err != nil {
+		t.Errorf("release_version_1.15.0-dev in the fork is not based on upstream master: %v", err)
+	}
+	checkFormats(ctx, t, "1.14.0")
+
+	// A fix merged on the release branch after 1.14.0.
+	num := addMergedPR(t, fake, "v1.14.x", "Fix a crash (#%v)", &fakegithub.PR{Title: "Fix a crash", Author: "contributor", Labels: []string{"Type: Bug"}})
+
+	t.Log("Release 1.14.1, syncing the fork, with a notes template")
+	*syncFork = true
+	tmpl := filepath.Join(dir, "notes.tmpl")
+	if err := ioutil.WriteFile(tmpl, []byte(testNotesTemplate), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.NotesTemplate = tmpl
+	if err := runTestRelease(ctx, "1.14.1"); err != nil {
+		t.Fatal(err)
+	}
+	cfg.NotesTemplate = ""
+	if _, err := fake.File(testUser, testRepo, "master", "upstream.go"); err != nil {
+		t.Errorf("master in the fork is not synced with upstream: %v", err)
+	}
+	checkFile("release_version_1.14.1", `"1.14.1"`)
+	checkFile("release_version_1.14.2-dev", `"1.14.2-dev"`)
+	notes = checkRelease(t, fake, "v1.14.1")
+	wantNotes := fmt.Sprintf("## Bug Fixes (1 change)\n- Fix a crash [#%v](https://github.com/grpc/grpc-go/pull/%v)\nThanks contributor!\n", num, num)
+	if notes != wantNotes {
+		t.Errorf("1.14.1 notes are not rendered with the template, want:\n%v\ngot:\n%v", wantNotes, notes)
+	}
+	checkClone()
+
+	// There's no milestone for 1.15, so the release must stop before creating
+	// a release with empty notes.
+	t.Log("Release 1.15.0, without a milestone")
+	if err := runTestRelease(ctx, "1.15.0"); err == nil || !strings.Contains(err.Error(), "no milestone") {
+		t.Errorf("1.15.0 without a milestone: want error about the milestone, got %v", err)
+	}
+	if findRelease(fake, "v1.15.0") != nil {
+		t.Errorf("release v1.15.0 was created without a milestone")
+	}
+
+	t.Log("Release 1.14.2, as a github app")
+	num = addMergedPR(t, fake, "v1.14.x", "Fix another crash (#%v)", &fakegithub.PR{Title: "Fix another crash", Author: "contributor", Labels: []string{"Type: Bug"}})
+	useApp(t, fake)
+	// Clone into memory this time.
+	*workdir = ""
+	// And with other section names.
+	cfg.Labels = &config.Labels{
+		Prefix: "Type: ",
+		Sections: []*config.SectionLabel{
+			{Label: "Feature", Name: "Features"},
+			{Label: "Bug", Name: "Fixes"},
+		},
+	}
+	if err := runTestRelease(ctx, "1.14.2"); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Labels = nil
+	// Apps can't fork, so the branch is pushed to upstream.
+	got, err := fake.File(testUpstream, testRepo, "release_version_1.14.2", "version.go")
+	if err != nil || !strings.Contains(got, `"1.14.2"`) {
+		t.Errorf("release_version_1.14.2 in upstream: want version 1.14.2, got %q, err %v", got, err)
+	}
+	name, email, err := fake.Author(testUpstream, testRepo, "release_version_1.14.2")
+	if err != nil || name != "release-bot[bot]" || email != "40001+release-bot[bot]@users.noreply.github.com" {
+		t.Errorf("release_version_1.14.2: want the commit by the app's bot, got %v <%v>, err %v", name, email, err)
+	}
+	notes = checkRelease(t, fake, "v1.14.2")
+	if want := fmt.Sprintf("# Fixes\n\n * Fix another crash (#%v)", num); !strings.Contains(notes, want) {
+		t.Errorf("1.14.2 notes don't have the fix in the Fixes section:\n%v", notes)
+	}
+
+	// The failed 1.15.0 release cut v1.15.x, the subtests add PRs on it.
+	t.Run("NotesFromCommits", func(t *testing.T) { testNotesFromCommits(ctx, t, fake) })
+	t.Run("NotesAudit", func(t *testing.T) { testNotesAudit(ctx, t, fake) })
+	t.Run("Contributors", func(t *testing.T) { testContributors(ctx, t, fake) })
+}
+
+// TestRerunSteps checks that rerunning the steps that failed after pushing,
+// or after creating the PR or the draft release, doesn't fail or make them
+// again.
+func TestRerunSteps(t *testing.T) {
+	ctx := context.Background()
+	fake := newTestFake(t)
+	fake.AutoMerge = false
+	fake.AutoPublish = false
+
+	for i := 0; i < 2; i++ {
+		r, err := newTestReleaser(ctx, "1.14.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if err := r.createReleaseBranch(ctx); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			// The branch pushed by the first run is not an ancestor of the
+			// rerun's.
+			if _, err := fake.Commit(testUser, testRepo, "release_version_1.14.0", "Diverge", map[string]string{"diverge.go": "package grpc\n"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := r.makeVersionPR(ctx); err != nil {
+			t.Fatalf("run %v: %v", i, err)
+		}
+		if err := r.createDraftRelease(ctx); err != nil {
+			t.Fatalf("run %v: %v", i, err)
+		}
+		r.close()
+	}
+
+	if _, err := fake.File(testUser, testRepo, "release_version_1.14.0", "diverge.go"); err == nil {
+		t.Errorf("release_version_1.14.0 in the fork was not replaced by the rerun")
+	}
+	var prs int
+	for _, pr := range fake.PullRequests(testUpstream, testRepo) {
+		if pr.GetTitle() == "Change version to 1.14.0" {
+			prs++
+		}
+	}
+	if prs != 1 {
+		t.Errorf("got %v PRs to change the version to 1.14.0, want 1", prs)
+	}
+	if n := len(fake.Releases(testUpstream, testRepo)); n != 1 {
+		t.Errorf("got %v releases, want 1", n)
+	}
+	if rel := findRelease(fake, "v1.14.0"); rel == nil || !rel.GetDraft() {
+		t.Errorf("release v1.14.0: want a draft release, got %v", rel)
+	}
+}
+
+// TestDryRun checks that a dry run of a new minor release, whose release branch
+// is only recorded, makes the version changes without changing github.
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	fake := newTestFake(t)
+	recorder = dryrun.New()
+
+	if err := runTestRelease(ctx, "1.14.0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.File(testUpstream, testRepo, "v1.14.x", "version.go"); err == nil {
+		t.Errorf("release branch v1.14.x was created in dry run")
+	}
+	if _, err := fake.File(testUser, testRepo, "release_version_1.14.0", "version.go"); err == nil {
+		t.Errorf("release_version_1.14.0 was pushed in dry run")
+	}
+	if n := len(fake.Releases(testUpstream, testRepo)); n != 0 {
+		t.Errorf("got %v releases in dry run, want 0", n)
+	}
+
+	var got []string
+	for _, m := range recorder.Mutations() {
+		got = append(got, m.Kind)
+		if m.Kind == "push" && strings.Contains(m.Summary, "release_version_1.14.0") && !strings.Contains(m.Detail, `+const Version = "1.14.0"`) {
+			t.Errorf("push of release_version_1.14.0: want the version change, got diff:\n%v", m.Detail)
+		}
+	}
+	want := []string{
+		"CreateRef",
+		"push", "PullRequests.Create",
+		"CreateRelease",
+		"push", "PullRequests.Create",
+		"push", "PullRequests.Create",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dry run mutations: got %v, want %v", got, want)
+	}
+}
+
+// TestBackport checks that only the labeled PRs merged after the release branch
+// was branched are backported.
+func TestBackport(t *testing.T) {
+	const (
+		base     = "a\nb\nc\nd\ne\nf\n"
+		released = "a\nb (release)\nc\nd\ne\nf\n"
+		fixed    = "a\nb\nc\nd\ne (fix)\nf\n"
+		merged   = "a\nb (release)\nc\nd\ne (fix)\nf\n"
+	)
+	for _, tt := range []struct {
+		name      string
+		label     string
+		milestone string
+	}{
+		{name: "label", label: "backport"},
+		{name: "milestone", milestone: "1.14.1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := newTestFake(t)
+			saveGlobals(t, backportLabel, backportMilestone, backportCombined)
+			*backportLabel = tt.label
+			*backportMilestone = tt.milestone
+			var labels []string
+			if tt.label != "" {
+				labels = []string{tt.label}
+			}
+
+			if _, err := fake.Commit(testUpstream, testRepo, "master", "Add merge.go", map[string]string{"merge.go": base}); err != nil {
+				t.Fatal(err)
+			}
+			r, err := newTestReleaser(ctx, "1.14.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.createReleaseBranch(ctx); err != nil {
+				t.Fatal(err)
+			}
+			r.close()
+			if _, err := fake.Commit(testUpstream, testRepo, "v1.14.x", "Change merge.go on the release branch", map[string]string{"merge.go": released}); err != nil {
+				t.Fatal(err)
+			}
+
+			// Merged before the release branch, but its commit isn't on it,
+			// like a PR that was backported to an older release branch.
+			old := addMergedPR(t, fake, "master", "Old fix (#%v)", &fakegithub.PR{
+				Title:     "Old fix",
+				Author:    "member",
+				Labels:    labels,
+				Milestone: tt.milestone,
+				MergedAt:  time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+			})
+			// Changes other lines of merge.go than the release branch.
+			fix := addMergedPR(t, fake, "master", "", &fakegithub.PR{
+				Title:     "New fix",
+				Author:    "member",
+				Labels:    labels,
+				Milestone: tt.milestone,
+			})
+			sha, err := fake.Commit(testUpstream, testRepo, "master", fmt.Sprintf("New fix (#%v)", fix), map[string]string{"merge.go": fixed})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := fake.SetMergeCommit(testUpstream, testRepo, fix, sha); err != nil {
+				t.Fatal(err)
+			}
+
+			*newVersion = "1.14.1"
+			if err := runBackport(ctx); err != nil {
+				t.Fatal(err)
+			}
+			checkPRs(t, fake, map[string]string{
+				fmt.Sprintf("Cherry-pick #%v to v1.14.x", fix): "v1.14.x",
+			})
+			for _, pr := range fake.PullRequests(testUpstream, testRepo) {
+				if pr.GetTitle() == fmt.Sprintf("Cherry-pick #%v to v1.14.x", old) {
+					t.Errorf("PR #%v merged before the release branch was backported", old)
+				}
+			}
+			got, err := fake.File(testUser, testRepo, fmt.Sprintf("backport_%v_to_v1.14.x", fix), "merge.go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != merged {
+				t.Errorf("merge.go after the backport = %q, want %q", got, merged)
+			}
+		})
+	}
+}
+
+// findRelease returns the release for the tag, or nil if there's none.
+func findRelease(fake *fakegithub.Server, tag string) *github.RepositoryRelease {
+	for _, rel := range fake.Releases(testUpstream, testRepo) {
+		if rel.GetTagName() == tag {
+			return rel
+		}
+	}
+	return nil
+}
+
+// checkRelease checks that the release for the tag was created and published,
+// and returns its notes.
+func checkRelease(t *testing.T, fake *fakegithub.Server, tag string) string {
+	t.Helper()
+	rel := findRelease(fake, tag)
+	if rel == nil {
+		t.Errorf("release %v was not created", tag)
+		return ""
+	}
+	if rel.GetDraft() {
+		t.Errorf("release %v is not published", tag)
+	}
+	if rel.GetTargetCommitish() != "v1.14.x" {
+		t.Errorf("release %v: want target v1.14.x, got %v", tag, rel.GetTargetCommitish())
+	}
+	return rel.GetBody()
+}
+
+// checkPRs checks that the PRs with the titles were sent to the base branches.
+func checkPRs(t *testing.T, fake *fakegithub.Server, want map[string]string) {
+	t.Helper()
+	got := make(map[string]string)
+	for _, pr := range fake.PullRequests(testUpstream, testRepo) {
+		got[pr.GetTitle()] = pr.GetBase().GetRef()
+	}
+	for title, base := range want {
+		if got[title] != base {
+			t.Errorf("PR %q: want base %q, got %q", title, base, got[title])
+		}
+	}
+}
+
+// checkFormats checks that the notes for version are rendered in all the
+// formats, with the same PRs.
+func checkFormats(ctx context.Context, t *testing.T, version string) {
+	t.Helper()
+	upstream, err := newUpstreamClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns, err := releaseNote(ctx, upstream, semver.MustParse(version))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range notes.Formats() {
+		r, err := notes.RendererForFormat(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := r.Render(ns)
+		if err != nil || !strings.Contains(s, "Add a feature") || !strings.Contains(s, "contributor") {
+			t.Errorf("%v notes in %v: want the feature PR and its author, got %q, err %v", version, f, s, err)
+		}
+	}
+	s, _ := notes.JSONRenderer{}.Render(ns)
+	var got notes.Notes
+	if err := json.Unmarshal([]byte(s), &got); err != nil || !reflect.DeepEqual(&got, ns) {
+		t.Errorf("%v notes in json don't unmarshal to the same notes, err %v", version, err)
+	}
+}
+
+func prNumbers(prs []*github.Issue) []int {
+	var ret []int
+	for _, pr := range prs {
+		ret = append(ret, pr.GetNumber())
+	}
+	return ret
+}
+
+// testNotesFromCommits checks that the notes from the commits on the release
+// branch have the PRs that merged them, even without the PR number in the
+// commit message, and that the PRs not in both the commits and the milestone
+// are found.
+func testNotesFromCommits(ctx context.Context, t *testing.T, fake *fakegithub.Server) {
+	milestone := fmt.Sprintf(cfg.MilestoneFormat, 1, 15)
+	streaming := addMergedPR(t, fake, "v1.15.x", "Add streaming (#%v)", &fakegithub.PR{Title: "Add streaming", Author: "contributor", Labels: []string{"Type: Feature"}, Milestone: milestone})
+	dialing := addMergedPR(t, fake, "v1.15.x", "Speed up dialing", &fakegithub.PR{Title: "Speed up dialing", Author: "contributor", Labels: []string{"Type: Performance"}})
+	forgotten := addMergedPR(t, fake, "v1.15.x", "", &fakegithub.PR{Title: "Forgotten", Author: "contributor", Labels: []string{"Type: Bug"}, Milestone: milestone})
+
+	saveGlobals(t, &cfg.NotesSource)
+	cfg.NotesSource = config.NotesFromCommits
+	upstream, err := newUpstreamClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ver := semver.MustParse("1.15.0")
+	ns, err := releaseNote(ctx, upstream, ver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes := ns.ToMarkdown()
+	for _, want := range []string{fmt.Sprintf("Add streaming (#%v)", streaming), fmt.Sprintf("Speed up dialing (#%v)", dialing)} {
+		if !strings.Contains(notes, want) {
+			t.Errorf("1.15.0 notes from the commits don't have %q:\n%v", want, notes)
+		}
+	}
+	if strings.Contains(notes, "Forgotten") {
+		t.Errorf("1.15.0 notes from the commits have a PR without commits:\n%v", notes)
+	}
+
+	prs, err := notesPRs(ctx, upstream, ver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notInMilestone, onlyInMilestone, err := milestoneMismatch(ctx, upstream, ver, prs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prNumbers(notInMilestone); !reflect.DeepEqual(got, []int{dialing}) {
+		t.Errorf("1.15.0 PRs not in the milestone: want [%v], got %v", dialing, got)
+	}
+	if got := prNumbers(onlyInMilestone); !reflect.DeepEqual(got, []int{forgotten}) {
+		t.Errorf("1.15.0 PRs only in the milestone: want [%v], got %v", forgotten, got)
+	}
+}
+
+// testNotesAudit checks that the audit of the 1.15.0 PRs finds the problems,
+// and fails.
+func testNotesAudit(ctx context.Context, t *testing.T, fake *fakegithub.Server) {
+	milestone := fmt.Sprintf(cfg.MilestoneFormat, 1, 15)
+	first := addMergedPR(t, fake, "v1.15.x", "Fix a bug (#%v)", &fakegithub.PR{Title: "Fix a bug", Author: "contributor", Labels: []string{"Type: Bug", "Type: Feature"}, Milestone: milestone, Body: "Release notes - fixed the bug"})
+	second := addMergedPR(t, fake, "v1.15.x", "Fix a bug (#%v)", &fakegithub.PR{Title: "Fix a bug", Author: "contributor", Labels: []string{"Type: Bug"}, Milestone: milestone})
+
+	upstream, err := newUpstreamClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prs, gotMilestone, err := auditPRs(ctx, upstream, semver.MustParse("1.15.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotMilestone != milestone {
+		t.Errorf("1.15.0 audit: want milestone %q, got %q", milestone, gotMilestone)
+	}
+	reasons := make(map[string][]string)
+	for _, f := range notes.Audit(prs, gotMilestone, labelConfig()).Problems {
+		reasons[f.PR.GetTitle()] = append(reasons[f.PR.GetTitle()], f.Reason)
+	}
+	for title, want := range map[string][]string{
+		"Speed up dialing": {"no milestone"},
+		"Fix a bug":        {"conflicting type labels [Feature Bug]", "malformed release notes marker", fmt.Sprintf("is also used by #%v", second), fmt.Sprintf("is also used by #%v", first)},
+	} {
+		got := strings.Join(reasons[title], "\n")
+		for _, w := range want {
+			if !strings.Contains(got, w) {
+				t.Errorf("1.15.0 audit of %q: want %q, got:\n%v", title, w, got)
+			}
+		}
+	}
+	if got := reasons["Add streaming"]; len(got) != 0 {
+		t.Errorf("1.15.0 audit of %q: want no problems, got %v", "Add streaming", got)
+	}
+
+	*newVersion = "1.15.0"
+	if err := runNotesAudit(ctx); err == nil {
+		t.Errorf("1.15.0 audit: want an error for the problems, got nil")
+	}
+}
+
+// testContributors checks that the 1.15.0 notes end with the contributors,
+// without the org members, and with the new contributor whose first PR is
+// merged after 1.14.0.
+func testContributors(ctx context.Context, t *testing.T, fake *fakegithub.Server) {
+	upstream, err := newUpstreamClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		version, want, wantErr string
+	}{
+		{version: "1.15.0", want: "v1.14.0"},
+		{version: "1.14.3", want: "v1.14.2"},
+		{version: "1.13.0", wantErr: "set -since"},
+	} {
+		got, err := contributorsCutoff(ctx, upstream, semver.MustParse(tt.version))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("contributorsCutoff(%v) error = %v, want %q", tt.version, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("contributorsCutoff(%v) = %q, %v, want %q", tt.version, got, err, tt.want)
+		}
+	}
+
+	// The fake's commits and PRs are all in 2018, so the contributor needs an
+	// older PR to not be new.
+	addMergedPR(t, fake, "", "", &fakegithub.PR{
+		Title:    "Add the first feature",
+		Author:   "contributor",
+		Labels:   []string{"Type: Feature"},
+		MergedAt: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	addMergedPR(t, fake, "v1.15.x", "Fix the docs (#%v)", &fakegithub.PR{Title: "Fix the docs", Author: "newcomer", Labels: []string{"Type: Documentation"}, MergedAt: time.Now()})
+	addMergedPR(t, fake, "v1.15.x", "Clean up the docs (#%v)", &fakegithub.PR{Title: "Clean up the docs", Author: "member", Labels: []string{"Type: Internal Cleanup"}})
+
+	saveGlobals(t, &cfg.NotesSource)
+	cfg.NotesSource = config.NotesFromCommits
+	ns, err := releaseNote(ctx, upstream, semver.MustParse("1.15.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ns.ToMarkdown()
+	want := "# Contributors\n\nThanks to everyone who contributed to this release: @contributor, @newcomer\n\nWelcome to the new contributors: @newcomer\n\n"
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("1.15.0 notes: want them to end with\n%q\ngot\n%q", want, got)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// releaseState is the progress of one release. It's saved to a local file
+// after every step, so a release interrupted halfway can be resumed with
+// -resume.
+type releaseState struct {
+	Version      string `json:"version"`
+	UpstreamUser string `json:"upstream_user"`
+	Repo         string `json:"repo"`
+
+	ReleaseBranch string `json:"release_branch"`
+
+	// PR URLs, keyed by the version they change to.
+	PRURLs     map[string]string `json:"pr_urls"`
+	ReleaseURL string            `json:"release_url"`
+
+	// CompletedSteps contains the names of the steps that have finished.
+	CompletedSteps []string `json:"completed_steps"`
+
+	path string
+}
+
+func newReleaseState(path string) *releaseState {
+	return &releaseState{
+		PRURLs: make(map[string]string),
+		path:   path,
+	}
+}
+
+// loadReleaseState reads the state from file.
+func loadReleaseState(path string) (*releaseState, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := newReleaseState(path)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %q: %v", path, err)
+	}
+	if s.PRURLs == nil {
+		s.PRURLs = make(map[string]string)
+	}
+	return s, nil
+}
+
+// save writes the state to file. The file is replaced atomically, so a crash
+// in the middle of saving doesn't lose the previous state.
+//
+// It does nothing if the state has no file.
+func (s *releaseState) save() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp state file: %v", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *releaseState) isCompleted(step string) bool {
+	for _, c := range s.CompletedSteps {
+		if c == step {
+			return true
+		}
+	}
+	return false
+}
+
+// markCompleted records step as finished and saves the state.
+func (s *releaseState) markCompleted(step string) error {
+	if !s.isCompleted(step) {
+		s.CompletedSteps = append(s.CompletedSteps, step)
+	}
+	return s.save()
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"strings"
 	"sync"
 
 	"github.com/blang/semver"
 	"github.com/google/go-github/github"
+	"github.com/menghanl/release-git-bot/config"
 	"github.com/menghanl/release-git-bot/ghclient"
 	"github.com/menghanl/release-git-bot/notes"
 
@@ -22,43 +26,355 @@ func commaStringToSet(s string) map[string]struct{} {
 	return ret
 }
 
-func releaseNote(c *ghclient.Client, ver semver.Version) string {
-	milestone := fmt.Sprintf("%v.%v Release", ver.Major, ver.Minor)
+// notesRenderer returns the renderer for the release notes format. The
+// markdown notes are rendered with the notes_template from the config, if
+// it's set.
+func notesRenderer(format string) (notes.Renderer, error) {
+	if format != "markdown" || cfg.NotesTemplate == "" {
+		return notes.RendererForFormat(format)
+	}
+	b, err := ioutil.ReadFile(cfg.NotesTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read release notes template: %v", err)
+	}
+	return notes.NewTemplateRenderer(string(b))
+}
+
+// labelConfig returns the label config for the notes, from the repo config.
+// It's nil if the config has neither labels nor areas, for the default labels.
+func labelConfig() *notes.LabelConfig {
+	if cfg.Labels == nil && cfg.Areas == nil {
+		return nil
+	}
+	ret := notes.DefaultLabelConfig()
+	if cfg.Labels != nil {
+		ret = &notes.LabelConfig{
+			Prefix:  cfg.Labels.Prefix,
+			Default: cfg.Labels.Default,
+			Exclude: cfg.Labels.Exclude,
+		}
+		for _, s := range cfg.Labels.Sections {
+			ret.Sections = append(ret.Sections, &notes.SectionLabel{
+				Label: s.Label,
+				Name:  s.Name,
+			})
+		}
+	}
+	if cfg.Areas != nil {
+		ret.Areas = &notes.AreaConfig{
+			LabelPrefix: cfg.Areas.LabelPrefix,
+			FromTitle:   cfg.Areas.FromTitle,
+		}
+	}
+	return ret
+}
 
+// releaseNote generates the release notes for ver.
+//
+// It fails if no merged PRs are found, so a release never gets empty notes
+// because of a wrong milestone or tag.
+func releaseNote(ctx context.Context, c *ghclient.Client, ver semver.Version) (*notes.Notes, error) {
 	var (
 		prs          []*github.Issue
+		prsErr       error
 		thanksFilter func(pr *github.Issue) bool
+		thanksErr    error
 	)
 
 	var wg sync.WaitGroup
 
 	wg.Add(1)
 	go func() {
-		prs = c.GetMergedPRsForMilestone(milestone)
-		wg.Done()
+		defer wg.Done()
+		prs, prsErr = notesPRs(ctx, c, ver)
 	}()
-	if *thanks {
+	if *thanks || *contributors {
 		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			urwelcomeMap := commaStringToSet(*urwelcome)
 			verymuchMap := commaStringToSet(*verymuch)
-			grpcMembers := c.GetOrgMembers("grpc")
+			var orgMembers map[string]struct{}
+			orgMembers, thanksErr = c.GetOrgMembers(ctx, cfg.ThanksOrg)
 			thanksFilter = func(pr *github.Issue) bool {
 				user := pr.GetUser().GetLogin()
-				_, isGRPCMember := grpcMembers[user]
+				_, isOrgMember := orgMembers[user]
 				_, isWelcome := urwelcomeMap[user]
 				_, isVerymuch := verymuchMap[user]
-				return *thanks && (isVerymuch || (!isGRPCMember && !isWelcome))
+				return isVerymuch || (!isOrgMember && !isWelcome)
 			}
-			wg.Done()
 		}()
 	}
 	wg.Wait()
+	if prsErr != nil {
+		return nil, prsErr
+	}
+	if thanksErr != nil {
+		// Without the members, everyone would be thanked.
+		return nil, fmt.Errorf("%v, rerun with -thanks=false -contributors=false to skip the thank you notes and the contributors", thanksErr)
+	}
 
-	ns := notes.GenerateNotes(c.Owner(), c.Repo(), "v"+ver.String(), prs, notes.Filters{
-		SpecialThanks: thanksFilter,
-	})
+	var filters notes.Filters
+	if *thanks {
+		filters.SpecialThanks = thanksFilter
+	}
+	if *contributors {
+		filters.Contributor = thanksFilter
+		newContributors, err := newContributors(ctx, c, ver, prs, thanksFilter)
+		if err != nil {
+			return nil, err
+		}
+		filters.NewContributor = func(login string) bool { return newContributors[login] }
+	}
+	ns := notes.GenerateNotes(c.Owner(), c.Repo(), "v"+ver.String(), prs, labelConfig(), filters)
 
 	log.Infof("generated notes for %v/%v/%v", c.Owner(), c.Repo(), "v"+ver.String())
-	return ns.ToMarkdown()
+	return ns, nil
+}
+
+// newContributors returns the set of the authors of the PRs that pass filter,
+// and have no merged PR before the cutoff from contributorsCutoff.
+func newContributors(ctx context.Context, c *ghclient.Client, ver semver.Version, prs []*github.Issue, filter func(pr *github.Issue) bool) (map[string]bool, error) {
+	base, err := contributorsCutoff(ctx, c, ver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the new contributors: %v, or rerun with -contributors=false", err)
+	}
+	date, err := c.CommitDate(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+	var logins []string
+	seen := make(map[string]bool)
+	for _, pr := range prs {
+		login := pr.GetUser().GetLogin()
+		if login != "" && !seen[login] && filter(pr) {
+			seen[login] = true
+			logins = append(logins, login)
+		}
+	}
+	ret, err := c.FirstTimeContributors(ctx, logins, date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the new contributors: %v, rerun with -contributors=false to skip the contributors", err)
+	}
+	return ret, nil
+}
+
+// notesPRs returns the merged PRs for the release notes of ver, from the
+// notes_source in the config.
+//
+// From the milestone, the PRs are the ones in the milestone, or for patch
+// releases, the ones in the commits since the previous patch release. From
+// the commits, the PRs are the ones associated with the commits since the
+// previous release, and they are cross-checked with the milestone.
+func notesPRs(ctx context.Context, c *ghclient.Client, ver semver.Version) ([]*github.Issue, error) {
+	switch cfg.NotesSource {
+	case "", config.NotesFromMilestone:
+		if ver.Patch > 0 {
+			// For patch releases, only include the changes since the
+			// previous patch release.
+			prevTag := fmt.Sprintf("v%v.%v.%v", ver.Major, ver.Minor, ver.Patch-1)
+			prs, err := c.GetMergedPRsBetween(ctx, prevTag, releaseBranchName(ver))
+			if err == nil && len(prs) == 0 {
+				err = fmt.Errorf("no merged PRs found between %v and %v", prevTag, releaseBranchName(ver))
+			}
+			return prs, err
+		}
+		milestone := fmt.Sprintf(cfg.MilestoneFormat, ver.Major, ver.Minor)
+		prs, err := c.GetMergedPRsForMilestone(ctx, milestone)
+		if err == nil && len(prs) == 0 {
+			err = fmt.Errorf("no merged PRs found in milestone %q", milestone)
+		}
+		return prs, err
+	case config.NotesFromCommits:
+		base, head, err := commitRange(ctx, c, ver)
+		if err != nil {
+			return nil, err
+		}
+		prs, err := c.GetMergedPRsForCommits(ctx, base, head)
+		if err != nil {
+			return nil, err
+		}
+		if len(prs) == 0 {
+			return nil, fmt.Errorf("no merged PRs found for the commits in %v...%v", base, head)
+		}
+		// Patch releases share the milestone with the other releases on the
+		// branch, so only the first release is cross-checked.
+		if ver.Patch == 0 {
+			if err := reportMilestoneMismatch(ctx, c, ver, base, head, prs); err != nil {
+				log.Warningf("failed to cross-check the PRs with the milestone: %v", err)
+			}
+		}
+		return prs, nil
+	}
+	return nil, fmt.Errorf("unknown notes_source %q, want %q or %q", cfg.NotesSource, config.NotesFromMilestone, config.NotesFromCommits)
+}
+
+// commitRange returns the range of commits in ver, from -since or the previous
+// release tag, to the release branch. Before the release branch is created,
+// the base branch is used.
+func commitRange(ctx context.Context, c *ghclient.Client, ver semver.Version) (base, head string, err error) {
+	base = *since
+	if base == "" {
+		if base, err = previousTag(ctx, c, ver); err != nil {
+			return "", "", err
+		}
+	}
+	head = releaseBranchName(ver)
+	exists, err := c.BranchExists(ctx, head)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to check release branch: %v", err)
+	}
+	if !exists {
+		log.Warningf("release branch %v doesn't exist, using %v", head, cfg.BaseBranch)
+		head = cfg.BaseBranch
+	}
+	return base, head, nil
+}
+
+// auditPRs returns the merged PRs to audit for ver, and the milestone they
+// should be in.
+//
+// For patch releases, they are the PRs of the notes, and the milestone is not
+// checked, because the PRs are in the milestone of the minor release.
+// Otherwise, they are the PRs of the commits since the previous release and the
+// PRs in the milestone, so the PRs missing from either are found.
+func auditPRs(ctx context.Context, c *ghclient.Client, ver semver.Version) ([]*github.Issue, string, error) {
+	if ver.Patch > 0 {
+		prs, err := notesPRs(ctx, c, ver)
+		return prs, "", err
+	}
+	base, head, err := commitRange(ctx, c, ver)
+	if err != nil {
+		return nil, "", err
+	}
+	prs, err := c.GetMergedPRsForCommits(ctx, base, head)
+	if err != nil {
+		return nil, "", err
+	}
+	milestone := fmt.Sprintf(cfg.MilestoneFormat, ver.Major, ver.Minor)
+	milestonePRs, err := c.GetMergedPRsForMilestone(ctx, milestone)
+	if err != nil {
+		return nil, "", err
+	}
+	seen := make(map[int]bool)
+	for _, pr := range prs {
+		seen[pr.GetNumber()] = true
+	}
+	for _, pr := range milestonePRs {
+		if !seen[pr.GetNumber()] {
+			prs = append(prs, pr)
+		}
+	}
+	if len(prs) == 0 {
+		return nil, "", fmt.Errorf("no merged PRs found for the commits in %v...%v or in milestone %q", base, head, milestone)
+	}
+	return prs, milestone, nil
+}
+
+// contributorsCutoff returns the ref whose commit date is the cutoff for the
+// new contributors: -since, or the previous patch release for patch releases,
+// or the first release of the previous minor version, e.g. v1.14.0 for 1.15.0.
+// The later patches of the previous minor version are made during this
+// release's cycle, so they are not the cutoff.
+func contributorsCutoff(ctx context.Context, c *ghclient.Client, ver semver.Version) (string, error) {
+	if *since != "" {
+		return *since, nil
+	}
+	prevTag, err := previousTag(ctx, c, ver)
+	if err != nil {
+		return "", err
+	}
+	if ver.Patch > 0 {
+		return prevTag, nil
+	}
+	prev, err := semver.Parse(strings.TrimPrefix(prevTag, "v"))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("v%v.%v.0", prev.Major, prev.Minor), nil
+}
+
+// previousTag returns the tag of the release before ver: the previous patch
+// release on the same branch for patch releases, or the latest release of an
+// older minor version. Pre-releases are skipped.
+func previousTag(ctx context.Context, c *ghclient.Client, ver semver.Version) (string, error) {
+	tags, err := c.ListTags(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list tags: %v", err)
+	}
+	var (
+		prevTag string
+		prev    semver.Version
+	)
+	for _, t := range tags {
+		v, err := semver.Parse(strings.TrimPrefix(t, "v"))
+		if err != nil || len(v.Pre) > 0 {
+			continue
+		}
+		sameBranch := v.Major == ver.Major && v.Minor == ver.Minor
+		if ver.Patch > 0 && (!sameBranch || v.Patch >= ver.Patch) {
+			continue
+		}
+		if ver.Patch == 0 && (sameBranch || v.GT(ver)) {
+			continue
+		}
+		if prevTag == "" || v.GT(prev) {
+			prevTag, prev = t, v
+		}
+	}
+	if prevTag == "" {
+		return "", fmt.Errorf("no release before %v found in the tags, set -since", ver)
+	}
+	return prevTag, nil
+}
+
+// milestoneMismatch returns the PRs in prs that are not in the milestone of
+// ver, and the merged PRs in the milestone that are not in prs.
+func milestoneMismatch(ctx context.Context, c *ghclient.Client, ver semver.Version, prs []*github.Issue) (notInMilestone, onlyInMilestone []*github.Issue, err error) {
+	milestone := fmt.Sprintf(cfg.MilestoneFormat, ver.Major, ver.Minor)
+	milestonePRs, err := c.GetMergedPRsForMilestone(ctx, milestone)
+	if err != nil {
+		return nil, nil, err
+	}
+	inPRs := make(map[int]bool)
+	for _, pr := range prs {
+		inPRs[pr.GetNumber()] = true
+	}
+	inMilestone := make(map[int]bool)
+	for _, pr := range milestonePRs {
+		inMilestone[pr.GetNumber()] = true
+		if !inPRs[pr.GetNumber()] {
+			onlyInMilestone = append(onlyInMilestone, pr)
+		}
+	}
+	for _, pr := range prs {
+		if !inMilestone[pr.GetNumber()] {
+			notInMilestone = append(notInMilestone, pr)
+		}
+	}
+	return notInMilestone, onlyInMilestone, nil
+}
+
+// reportMilestoneMismatch prints the PRs that are only in the commits in
+// base...head, or only in the milestone, to stderr, so the notes on stdout
+// are not changed.
+func reportMilestoneMismatch(ctx context.Context, c *ghclient.Client, ver semver.Version, base, head string, prs []*github.Issue) error {
+	notInMilestone, onlyInMilestone, err := milestoneMismatch(ctx, c, ver, prs)
+	if err != nil {
+		return err
+	}
+	milestone := fmt.Sprintf(cfg.MilestoneFormat, ver.Major, ver.Minor)
+	printPRs := func(title string, prs []*github.Issue) {
+		if len(prs) == 0 {
+			return
+		}
+		fmt.Fprintln(os.Stderr, title)
+		for _, pr := range prs {
+			fmt.Fprintf(os.Stderr, " - #%v %v (%v)\n", pr.GetNumber(), pr.GetTitle(), pr.GetHTMLURL())
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	printPRs(fmt.Sprintf("PRs in %v...%v but not in milestone %q, they are in the notes:", base, head, milestone), notInMilestone)
+	printPRs(fmt.Sprintf("PRs in milestone %q but not in %v...%v, they are not in the notes:", milestone, base, head), onlyInMilestone)
+	return nil
 }
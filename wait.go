@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/menghanl/release-git-bot/ghclient"
+	survey "gopkg.in/AlecAivazis/survey.v1"
+)
+
+// confirmManually blocks until the user answers yes to message.
+func confirmManually(message string) {
+	confirmed := false
+	for !confirmed {
+		prompt := &survey.Confirm{
+			Message: message,
+		}
+		survey.AskOne(prompt, &confirmed, nil)
+	}
+}
+
+// stopPolling is returned by the check in poll for errors that waiting won't
+// fix, to stop polling with the error.
+type stopPolling struct {
+	error
+}
+
+// poll calls check every interval until it returns true, or until timeout or
+// ctx is canceled.
+//
+// Errors from check are printed and don't stop the polling, so a flaky
+// network doesn't fail the release, except stopPolling errors, which are
+// returned.
+func poll(ctx context.Context, interval, timeout time.Duration, check func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		done, err := check()
+		if stop, ok := err.(stopPolling); ok {
+			return stop.error
+		}
+		if err != nil {
+			fmt.Printf("   ... %v\n", err)
+		}
+		if done {
+			return nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("timed out after %v", timeout)
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// waitPRMerged waits for the PR to be merged, printing the CI status while
+// waiting.
+func waitPRMerged(ctx context.Context, c *ghclient.Client, prURL string) error {
+	if recorder != nil {
+		fmt.Println("   dry run, not waiting")
+		return nil
+	}
+	if *manualConfirm {
+		confirmManually("Merged?")
+		return nil
+	}
+	num, err := ghclient.PRNumberFromURL(prURL)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	return poll(ctx, *pollInterval, *pollTimeout, func() (bool, error) {
+		status, err := c.GetPRStatus(ctx, num)
+		if err != nil {
+			return false, err
+		}
+		if status.Merged {
+			fmt.Printf("   PR #%v merged\n", num)
+			return true, nil
+		}
+		if status.Closed {
+			return false, stopPolling{fmt.Errorf("PR #%v was closed without merging, reopen and merge it", num)}
+		}
+		fmt.Printf("   [%v] PR #%v not merged yet, checks: %v\n", time.Since(start).Round(time.Second), num, checksToString(status.Checks))
+		return false, nil
+	})
+}
+
+// waitReleasePublished waits for the draft release with the tag to be
+// published.
+func waitReleasePublished(ctx context.Context, c *ghclient.Client, tagName string) error {
+	if recorder != nil {
+		fmt.Println("   dry run, not waiting")
+		return nil
+	}
+	if *manualConfirm {
+		confirmManually("Published?")
+		return nil
+	}
+	start := time.Now()
+	return poll(ctx, *pollInterval, *pollTimeout, func() (bool, error) {
+		published, err := c.IsReleasePublished(ctx, tagName)
+		if err != nil {
+			return false, err
+		}
+		if published {
+			fmt.Printf("   release %v published\n", tagName)
+			return true, nil
+		}
+		fmt.Printf("   [%v] release %v not published yet\n", time.Since(start).Round(time.Second), tagName)
+		return false, nil
+	})
+}
+
+func checksToString(checks []*ghclient.CheckStatus) string {
+	if len(checks) == 0 {
+		return "none"
+	}
+	var ret []string
+	for _, c := range checks {
+		ret = append(ret, fmt.Sprintf("%v: %v", c.Name, c.State))
+	}
+	return strings.Join(ret, ", ")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/menghanl/release-git-bot/internal/fakegithub"
+)
+
+func TestWaitPRMerged(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		merged  bool
+		wantErr string
+	}{
+		{name: "merged", merged: true},
+		{name: "closed without merging", wantErr: "closed without merging"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := newTestFake(t)
+			num, err := fake.AddPR(testUpstream, testRepo, &fakegithub.PR{
+				Title:  "Release 1.14.0",
+				Author: testUser,
+				Merged: tt.merged,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			upstream, err := newUpstreamClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			err = waitPRMerged(ctx, upstream, fmt.Sprintf("https://github.com/%v/%v/pull/%v", testUpstream, testRepo, num))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("waitPRMerged() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("waitPRMerged() error = %v, want %q", err, tt.wantErr)
+			}
+			// It fails right away, not after the poll timeout.
+			if d := time.Since(start); d >= *pollTimeout {
+				t.Errorf("waitPRMerged() returned after %v, want right away", d)
+			}
+		})
+	}
+}